@@ -0,0 +1,136 @@
+package pgit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	git "github.com/gogs/git-module"
+	"golang.org/x/sync/errgroup"
+)
+
+// formats passed to `git archive --format`
+var archiveFormats = []string{"tar.gz", "zip"}
+
+// archiveData links to the snapshots of a rev or tag and their checksums.
+type archiveData struct {
+	Name      string
+	TarURL    template.URL
+	TarSumURL template.URL
+	ZipURL    template.URL
+	ZipSumURL template.URL
+}
+
+// archiveName is the file name without an extension and the directory the
+// archive extracts to, e.g. `pgit-v1.0.0`.
+func (c *config) archiveName(ref string) string {
+	replacer := strings.NewReplacer("/", "-", " ", "-")
+	return replacer.Replace(fmt.Sprintf("%s-%s", c.RepoName, ref))
+}
+
+// controls the url for archives
+// - /archives/{repo}-{ref}.tar.gz
+// - /archives/{repo}-{ref}.tar.gz.sha256.
+func (c *config) getArchiveURL(fname string) template.URL {
+	return c.compileURL("/archives", fname)
+}
+
+// getArchive returns the archive urls for a ref or nil when archives are
+// disabled.
+func (c *config) getArchive(ref string) *archiveData {
+	if !c.Archives {
+		return nil
+	}
+
+	name := c.archiveName(ref)
+	return &archiveData{
+		Name:      name,
+		TarURL:    c.getArchiveURL(name + ".tar.gz"),
+		TarSumURL: c.getArchiveURL(name + ".tar.gz.sha256"),
+		ZipURL:    c.getArchiveURL(name + ".zip"),
+		ZipSumURL: c.getArchiveURL(name + ".zip.sha256"),
+	}
+}
+
+// writeArchive writes every archive format of a commit along with a
+// `sha256sum` compatible checksum file. Archives of a commit we already wrote
+// in a previous build are skipped.
+func (c *config) writeArchive(repo *git.Repository, name, commitID string) error {
+	for _, format := range archiveFormats {
+		fname := fmt.Sprintf("%s.%s", name, format)
+		fp := filepath.Join(c.Outdir, "archives", fname)
+		sumPath := fp + ".sha256"
+		if c.Manifest.hasArchive(fname, commitID) && fileExists(fp) && fileExists(sumPath) {
+			c.Logger.Info("archive unchanged since last build, skipping", "filepath", fp)
+			c.Manifest.addArchive(fname, commitID)
+			continue
+		}
+
+		err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+		if err != nil {
+			return err
+		}
+
+		c.Logger.Info("writing", "filepath", fp)
+		f, err := os.Create(fp)
+		if err != nil {
+			return err
+		}
+
+		// hash the archive while we stream it to disk
+		h := sha256.New()
+		stderr := new(bytes.Buffer)
+		err = git.NewCommand(
+			"archive",
+			"--format="+format,
+			"--prefix="+name+"/",
+			commitID,
+		).RunInDirPipeline(io.MultiWriter(f, h), stderr, repo.Path())
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("%w: %s", err, stderr.String())
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+
+		sum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), fname)
+		err = os.WriteFile(sumPath, []byte(sum), 0644)
+		if err != nil {
+			return err
+		}
+		c.Manifest.addArchive(fname, commitID)
+	}
+	return nil
+}
+
+// writeArchives writes archives for every rev and, with `--archive-tags`,
+// every tag. An archive that fails is reported and skipped.
+func (c *config) writeArchives(repo *git.Repository, revs []*revData, tags []*tagData) error {
+	// a rev can also be a tag so we key by name
+	commits := map[string]string{}
+	for _, rev := range revs {
+		commits[c.archiveName(rev.Name())] = rev.ID()
+	}
+	if c.ArchiveTags {
+		for _, tag := range tags {
+			commits[c.archiveName(tag.Name)] = tag.Commit.ID.String()
+		}
+	}
+
+	var eg errgroup.Group
+	for name, commitID := range commits {
+		c.Pool.Go(&eg, func() error {
+			err := c.writeArchive(repo, name, commitID)
+			return c.reportErr(err, commitID, name)
+		})
+	}
+	return eg.Wait()
+}
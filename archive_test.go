@@ -0,0 +1,83 @@
+package pgit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	git "github.com/gogs/git-module"
+)
+
+func TestArchiveName(t *testing.T) {
+	tests := []struct {
+		repo string
+		ref  string
+		want string
+	}{
+		{"pgit", "v1.0.0", "pgit-v1.0.0"},
+		{"pgit", "feature/search", "pgit-feature-search"},
+		{"my repo", "main", "my-repo-main"},
+	}
+	for _, tt := range tests {
+		c := &config{RepoName: tt.repo}
+		got := c.archiveName(tt.ref)
+		if got != tt.want {
+			t.Errorf("archiveName(%q) of %q: got %q, want %q", tt.ref, tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	dir := testRepo(t)
+	commitID := testCommit(t, dir, 1, "first", map[string]string{"a.txt": "a\n"})
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testConfig(t)
+	c.RepoName = "demo"
+	c.Manifest = &buildManifest{prev: newManifest("", ""), next: newManifest("", "")}
+	err = c.writeArchive(repo, "demo-main", commitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fname := range []string{"demo-main.tar.gz", "demo-main.zip"} {
+		fp := filepath.Join(c.Outdir, "archives", fname)
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := os.ReadFile(fp + ".sha256")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha256.Sum256(b)
+		want := hex.EncodeToString(h[:]) + "  " + fname + "\n"
+		if string(sum) != want {
+			t.Errorf("%s: got checksum %q, want %q", fname, sum, want)
+		}
+	}
+
+	// the next build skips archives of the same commit
+	fp := filepath.Join(c.Outdir, "archives", "demo-main.zip")
+	err = os.WriteFile(fp, []byte("unchanged"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Manifest = &buildManifest{prev: c.Manifest.next, next: newManifest("", "")}
+	err = c.writeArchive(repo, "demo-main", commitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "unchanged" {
+		t.Error("archive of an unchanged commit was written again")
+	}
+}
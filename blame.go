@@ -0,0 +1,152 @@
+package pgit
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	formatterHtml "github.com/alecthomas/chroma/v2/formatters/html"
+	git "github.com/gogs/git-module"
+)
+
+// blameGroup is a run of consecutive lines last touched by the same commit.
+type blameGroup struct {
+	CommitID  string
+	ShortID   string
+	CommitURL template.URL
+	Summary   string
+	Author    string
+	When      string
+	Start     int
+	NumLines  int
+	Contents  template.HTML
+}
+
+type blamePageData struct {
+	*pageData
+	Item   *treeItem
+	Groups []*blameGroup
+}
+
+func getBlameFilename(name string) string {
+	return fmt.Sprintf("%s.blame.html", name)
+}
+
+// highlights a run of lines while keeping their line numbers from the file.
+func (c *config) formatLines(lines [][]chroma.Token, start int) (string, error) {
+	tokens := []chroma.Token{}
+	for _, line := range lines {
+		tokens = append(tokens, line...)
+	}
+
+	formatter := formatterHtml.New(
+		formatterHtml.WithLineNumbers(true),
+		formatterHtml.WithLinkableLineNumbers(true, ""),
+		formatterHtml.WithClasses(true),
+		formatterHtml.BaseLineNumber(start),
+	)
+	var buf bytes.Buffer
+	err := formatter.Format(&buf, c.Theme, chroma.Literator(tokens...))
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (c *config) writeBlame(repo *git.Repository, pageData *pageData, treeItem *treeItem, text string) error {
+	blame, err := repo.BlameFile(pageData.RevData.ID(), treeItem.Path)
+	if err != nil {
+		return err
+	}
+
+	lexer := getLexer(treeItem.Entry.Name(), text)
+	iterator, err := lexer.Tokenise(nil, text)
+	if err != nil {
+		return err
+	}
+	lines := chroma.SplitTokensIntoLines(iterator.Tokens())
+
+	groups := []*blameGroup{}
+	var cur *blameGroup
+	var curLines [][]chroma.Token
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		contents, err := c.formatLines(curLines, cur.Start)
+		if err != nil {
+			return err
+		}
+		cur.Contents = template.HTML(contents)
+		groups = append(groups, cur)
+		return nil
+	}
+
+	for i, line := range lines {
+		commit := blame.Line(i + 1)
+		// chroma can produce a trailing line that git does not know about
+		if commit == nil {
+			if cur != nil {
+				curLines = append(curLines, line)
+				cur.NumLines += 1
+			}
+			continue
+		}
+
+		commitID := commit.ID.String()
+		if cur != nil && cur.CommitID == commitID {
+			curLines = append(curLines, line)
+			cur.NumLines += 1
+			continue
+		}
+
+		err = flush()
+		if err != nil {
+			return err
+		}
+		cur = &blameGroup{
+			CommitID:  commitID,
+			ShortID:   getShortID(commitID),
+			CommitURL: c.getCommitURL(commitID),
+			Summary:   commit.Summary(),
+			Author:    commit.Author.Name,
+			When:      commit.Author.When.Format(time.DateOnly),
+			Start:     i + 1,
+			NumLines:  1,
+		}
+		curLines = [][]chroma.Token{line}
+	}
+	err = flush()
+	if err != nil {
+		return err
+	}
+
+	d := filepath.Dir(treeItem.Path)
+	treeItem.BlameURL = c.getFileURL(pageData.RevData, getBlameFilename(treeItem.Path))
+	err = c.writeHtml(&writeData{
+		Filename: getBlameFilename(treeItem.Entry.Name()),
+		Template: "blame.page.tmpl",
+		Data: &blamePageData{
+			pageData: pageData,
+			Item:     treeItem,
+			Groups:   groups,
+		},
+		Subdir: getFileDir(pageData.RevData, d),
+	})
+	if err != nil {
+		return err
+	}
+
+	// a line can be as old as the repo, way past the log
+	for _, group := range groups {
+		err = c.writeLinkedCommit(repo, pageData, group.CommitID)
+		err = c.reportErr(err, group.CommitID, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package pgit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Commits listed on a blame page get a commit page even when they are older
+// than the log.
+func TestBlameCommitPages(t *testing.T) {
+	dir := testRepo(t)
+	first := testCommit(t, dir, 1, "first", map[string]string{"a.txt": "a\n"})
+	testCommit(t, dir, 2, "second", map[string]string{"a.txt": "a\nb\n"})
+	outdir := t.TempDir()
+
+	report := testBuildOpts(t, Options{
+		RepoPath:    dir,
+		Outdir:      outdir,
+		MaxCommits:  1,
+		LogPageSize: 1,
+		NoHistory:   true,
+		Blame:       true,
+	})
+	if report.HasErrors() {
+		t.Fatal(report.Errors)
+	}
+	if !fileExists(filepath.Join(outdir, "commits", first+".html")) {
+		t.Fatal("commit linked from the blame page was not written")
+	}
+}
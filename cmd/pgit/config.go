@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/picosh/pgit"
+)
+
+// FileConfig is the config file passed with `--config`. Top-level keys are
+// the same as the flags (e.g. `clone-url`, `max-commits`) while every
+// `[[repos]]` table adds a repo to a multi-repo site.
+type FileConfig struct {
+	Settings map[string]any
+	Repos    []*pgit.RepoEntry
+}
+
+// paths in the config file are relative to the file itself.
+var configPathKeys = map[string]bool{
+	"out":        true,
+	"repo":       true,
+	"repos-dir":  true,
+	"repos-file": true,
+	"templates":  true,
+	"static":     true,
+}
+
+func loadConfigFile(fp string) (*FileConfig, error) {
+	raw := map[string]toml.Primitive{}
+	md, err := toml.DecodeFile(fp, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &FileConfig{Settings: map[string]any{}}
+	for key, prim := range raw {
+		if key == "repos" {
+			err = md.PrimitiveDecode(prim, &cfg.Repos)
+			if err != nil {
+				return nil, fmt.Errorf("%s: repos: %w", fp, err)
+			}
+			continue
+		}
+
+		if key == "config" || flag.Lookup(key) == nil {
+			return nil, fmt.Errorf("%s: unknown key %q", fp, key)
+		}
+
+		var value any
+		err = md.PrimitiveDecode(prim, &value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", fp, key, err)
+		}
+		cfg.Settings[key] = value
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown key %q", fp, undecoded[0].String())
+	}
+
+	dir := filepath.Dir(fp)
+	for key, value := range cfg.Settings {
+		str, ok := value.(string)
+		if ok && configPathKeys[key] && !filepath.IsAbs(str) {
+			cfg.Settings[key] = filepath.Join(dir, str)
+		}
+	}
+	for _, entry := range cfg.Repos {
+		if entry.Path == "" {
+			return nil, fmt.Errorf("%s: every repo requires a path", fp)
+		}
+		if !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(dir, entry.Path)
+		}
+	}
+
+	return cfg, nil
+}
+
+// configValue converts a toml value into the string form a flag expects.
+// Lists are joined with commas like `--revs`.
+func configValue(value any) string {
+	switch v := value.(type) {
+	case []any:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, configValue(item))
+		}
+		return strings.Join(items, ",")
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// applyFlags sets every flag from the config file that was not passed on the
+// command line.
+func (f *FileConfig) applyFlags(explicit map[string]bool) error {
+	for key, value := range f.Settings {
+		if explicit[key] {
+			continue
+		}
+		err := flag.Set(key, configValue(value))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setFlags returns the flags passed on the command line.
+func setFlags() map[string]bool {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	return explicit
+}
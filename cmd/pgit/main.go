@@ -0,0 +1,177 @@
+// Command pgit is a static site generator for git.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/picosh/pgit"
+)
+
+func main() {
+	var configFlag = flag.String("config", "", "path to a toml config file, flags passed on the command line take precedence")
+	var outdir = flag.String("out", pgit.DefaultOutdir, "output directory")
+	var rpath = flag.String("repo", ".", "path to git repo")
+	var revsFlag = flag.String("revs", "HEAD", "list of revs to generate logs and tree (e.g. main,v1,c69f86f,HEAD)")
+	var themeFlag = flag.String("theme", pgit.DefaultTheme, "theme to use for site")
+	var labelFlag = flag.String("label", "", "pretty name for the subdir where we create the repo, default is last folder in --repo")
+	var cloneFlag = flag.String("clone-url", "", "git clone URL for upstream")
+	var homeFlag = flag.String("home-url", "", "URL for breadcumbs to go to root page, hidden if empty")
+	var descFlag = flag.String("desc", "", "description for repo")
+	var readmeFlag = flag.String("readme", "", "name of the readme file shown on the summary page, default is README.md")
+	var templatesFlag = flag.String("templates", "", "directory of *.tmpl files that replace the embedded templates with the same name, other *.page.tmpl files become pages")
+	var staticFlag = flag.String("static", "", "directory of assets copied over the embedded css and js")
+	var rootRelativeFlag = flag.String("root-relative", pgit.DefaultRootRelative, "html root relative")
+	var baseURLFlag = flag.String("base-url", "", "absolute URL of the site root used for atom feeds (e.g. https://git.erock.io), feeds are skipped if empty")
+	var maxCommitsFlag = flag.Int("max-commits", 0, "maximum number of commits to generate, -1 generates every commit")
+	var logPageSizeFlag = flag.Int("log-page-size", pgit.DefaultLogPageSize, "number of commits on each page of the log")
+	var hideTreeLastCommitFlag = flag.Bool("hide-tree-last-commit", false, "dont calculate last commit for each file in the tree")
+	var noHistoryFlag = flag.Bool("no-history", false, "dont generate a history page for every file and directory, this reads the entire history of every rev")
+	var lastCommitCacheFlag = flag.Bool("last-commit-cache", false, "cache the last commit of every file between builds in pgit-lastcommits.json")
+	var blameFlag = flag.Bool("blame", false, "generate a blame page for every text file, this is expensive")
+	var diffViewFlag = flag.String("diff-view", "unified", "default view for diffs on commit pages, unified or split")
+	var maxFileSizeFlag = flag.Int64("max-file-size", 1024*1024, "files over this many bytes are not highlighted and only link to the raw file, 0 for no limit")
+	var maxFileLinesFlag = flag.Int("max-file-lines", 10000, "only highlight the first lines of longer files, 0 for no limit")
+	var maxDiffLinesFlag = flag.Int("max-diff-lines", 2000, "only show the first lines of a larger diff of a file, 0 for no limit")
+	var maxDiffFilesFlag = flag.Int("max-diff-files", 300, "only show the first files of a larger diff of a commit, 0 for no limit")
+	var jobsFlag = flag.Int("jobs", runtime.NumCPU(), "number of pages to render at once, shared by every rev and repo")
+	var archivesFlag = flag.Bool("archives", false, "write tar.gz and zip archives with sha256 checksums of every rev")
+	var archiveTagsFlag = flag.Bool("archive-tags", false, "with --archives also write archives of every tag")
+	var combinedDiffFlag = flag.Bool("combined-diff", false, "also show the combined diff (git show --cc) on merge commit pages")
+	var commitFilesFlag = flag.Bool("commit-files", false, "write every changed file before and after each commit so line numbers in diffs link to them, this doubles the pages of every commit")
+	var searchCodeFlag = flag.Bool("search-code", false, "add the contents of text files to the search index, this grows with the size of the repo")
+	var forceFlag = flag.Bool("force", false, "ignore the build manifest from previous runs and regenerate every page")
+	var failFastFlag = flag.Bool("fail-fast", false, "stop at the first page that fails instead of skipping it and reporting at the end")
+	var reposDirFlag = flag.String("repos-dir", "", "build every git repo inside this directory into its own subdir with an index page")
+	var reposFileFlag = flag.String("repos-file", "", "build every git repo listed in this file (one path per line) into its own subdir with an index page")
+
+	flag.Parse()
+
+	logger := slog.Default()
+
+	explicit := setFlags()
+	repoEntries := []*pgit.RepoEntry{}
+	if *configFlag != "" {
+		fileConfig, err := loadConfigFile(*configFlag)
+		if err != nil {
+			fatal(logger, err)
+		}
+		err = fileConfig.applyFlags(explicit)
+		if err != nil {
+			fatal(logger, err)
+		}
+		repoEntries = fileConfig.Repos
+	}
+
+	revs := strings.Split(*revsFlag, ",")
+	if len(revs) == 1 && revs[0] == "" {
+		fatal(logger, fmt.Errorf("you must provide --revs"))
+	}
+
+	repoPaths := []string{}
+	if *reposDirFlag != "" {
+		dir, err := filepath.Abs(*reposDirFlag)
+		if err != nil {
+			fatal(logger, err)
+		}
+		found, err := pgit.FindRepos(dir)
+		if err != nil {
+			fatal(logger, err)
+		}
+		repoPaths = append(repoPaths, found...)
+	}
+	if *reposFileFlag != "" {
+		fp, err := filepath.Abs(*reposFileFlag)
+		if err != nil {
+			fatal(logger, err)
+		}
+		found, err := pgit.ReadReposFile(fp)
+		if err != nil {
+			fatal(logger, err)
+		}
+		repoPaths = append(repoPaths, found...)
+	}
+	for _, repoPath := range repoPaths {
+		repoEntries = append(repoEntries, &pgit.RepoEntry{Path: repoPath})
+	}
+
+	opts := pgit.Options{
+		Outdir:             *outdir,
+		RepoPath:           *rpath,
+		Repos:              repoEntries,
+		Label:              *labelFlag,
+		Revs:               revs,
+		Desc:               *descFlag,
+		Readme:             *readmeFlag,
+		Theme:              *themeFlag,
+		CloneURL:           *cloneFlag,
+		HomeURL:            *homeFlag,
+		RootRelative:       *rootRelativeFlag,
+		BaseURL:            *baseURLFlag,
+		MaxCommits:         *maxCommitsFlag,
+		LogPageSize:        *logPageSizeFlag,
+		MaxFileSize:        *maxFileSizeFlag,
+		MaxFileLines:       *maxFileLinesFlag,
+		MaxDiffLines:       *maxDiffLinesFlag,
+		MaxDiffFiles:       *maxDiffFilesFlag,
+		Jobs:               *jobsFlag,
+		HideTreeLastCommit: *hideTreeLastCommitFlag,
+		LastCommitCache:    *lastCommitCacheFlag,
+		NoHistory:          *noHistoryFlag,
+		Blame:              *blameFlag,
+		DiffView:           *diffViewFlag,
+		CombinedDiff:       *combinedDiffFlag,
+		CommitFiles:        *commitFilesFlag,
+		Archives:           *archivesFlag,
+		ArchiveTags:        *archiveTagsFlag,
+		SearchCode:         *searchCodeFlag,
+		TemplatesDir:       *templatesFlag,
+		StaticDir:          *staticFlag,
+		Force:              *forceFlag,
+		FailFast:           *failFastFlag,
+		Logger:             logger,
+	}
+
+	// flags passed on the command line win over a repo's `.pgit.toml`
+	if explicit["desc"] {
+		opts.Override.Desc = opts.Desc
+	}
+	if explicit["readme"] {
+		opts.Override.Readme = opts.Readme
+	}
+	if explicit["theme"] {
+		opts.Override.Theme = opts.Theme
+	}
+	if explicit["revs"] {
+		opts.Override.Revs = opts.Revs
+	}
+
+	generator, err := pgit.NewGenerator(opts)
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	report, err := generator.Generate()
+	if err != nil {
+		fatal(logger, err)
+	}
+
+	url := filepath.Join("/", "index.html")
+	logger.Info("root url", "url", url)
+
+	report.Write(os.Stderr)
+	if report.HasErrors() {
+		os.Exit(1)
+	}
+}
+
+// fatal stops the build for errors we cannot skip over.
+func fatal(logger *slog.Logger, err error) {
+	logger.Error("build failed", "err", err)
+	os.Exit(1)
+}
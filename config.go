@@ -0,0 +1,95 @@
+package pgit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/chroma/v2/styles"
+	git "github.com/gogs/git-module"
+)
+
+// repoConfigFilename is the config a repo can commit at its default branch to
+// describe itself.
+const repoConfigFilename = ".pgit.toml"
+
+// RepoConfig holds the settings a repo is allowed to set for itself.
+type RepoConfig struct {
+	Desc   string   `toml:"desc"`
+	Readme string   `toml:"readme"`
+	Theme  string   `toml:"theme"`
+	Revs   []string `toml:"revs"`
+}
+
+// RepoEntry is a repo of a multi-repo site, the `[[repos]]` table of the
+// config file.
+type RepoEntry struct {
+	Path     string `toml:"path"`
+	Label    string `toml:"label"`
+	CloneURL string `toml:"clone-url"`
+	RepoConfig
+}
+
+// readRepoConfig reads the `.pgit.toml` committed at the default branch of a
+// repo, it returns nil when the repo does not have one. Unknown keys are an
+// error but the config is still returned with the keys we know.
+func readRepoConfig(repo *git.Repository) (*RepoConfig, error) {
+	commit, err := repo.CatFileCommit("HEAD")
+	if err != nil {
+		// empty repos do not have a HEAD commit
+		return nil, nil
+	}
+
+	blob, err := commit.Blob(repoConfigFilename)
+	if errors.Is(err, git.ErrRevisionNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := blob.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &RepoConfig{}
+	md, err := toml.Decode(string(b), rc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", repoConfigFilename, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return rc, fmt.Errorf("%s: unknown key %q", repoConfigFilename, undecoded[0].String())
+	}
+	return rc, nil
+}
+
+// applyRepoConfig overrides settings with the ones set in rc. Flags passed on
+// the command line always win.
+func (c *config) applyRepoConfig(rc *RepoConfig) {
+	if rc == nil {
+		return
+	}
+
+	if rc.Desc != "" && !c.SetFlags["desc"] {
+		c.Desc = rc.Desc
+	}
+	if rc.Readme != "" && !c.SetFlags["readme"] {
+		c.Readme = rc.Readme
+	}
+	if len(rc.Revs) > 0 && !c.SetFlags["revs"] {
+		c.Revs = rc.Revs
+	}
+	if rc.Theme != "" && !c.SetFlags["theme"] {
+		c.Theme = styles.Get(rc.Theme)
+		c.Markdown = newMarkdown(c.Theme)
+	}
+}
+
+// loadRepoConfig applies the config the repo committed for itself.
+func (c *config) loadRepoConfig(repo *git.Repository) error {
+	// a typo in the config is reported, the rest of it still applies
+	rc, err := readRepoConfig(repo)
+	c.applyRepoConfig(rc)
+	return err
+}
@@ -0,0 +1,28 @@
+package pgit
+
+import (
+	"strings"
+	"testing"
+
+	git "github.com/gogs/git-module"
+)
+
+// A typo in `.pgit.toml` is reported while the keys we know still apply.
+func TestReadRepoConfigUnknownKey(t *testing.T) {
+	dir := testRepo(t)
+	testCommit(t, dir, 1, "config", map[string]string{
+		repoConfigFilename: "desc = \"a repo\"\nthem = \"monokai\"\n",
+	})
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := readRepoConfig(repo)
+	if err == nil || !strings.Contains(err.Error(), `"them"`) {
+		t.Errorf("got err %v, want unknown key them", err)
+	}
+	if rc == nil || rc.Desc != "a repo" {
+		t.Errorf("got %+v, want desc to apply", rc)
+	}
+}
@@ -0,0 +1,388 @@
+package pgit
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	git "github.com/gogs/git-module"
+)
+
+var diffViews = []string{"unified", "split"}
+
+// root commits are diffed against the empty tree so every file shows as added.
+const emptyTreeID = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// diffRenderLine is a line of a diff. Line numbers are 0 when the line does
+// not exist on that side.
+type diffRenderLine struct {
+	// add, del or ctx
+	Type    string
+	OldNum  int
+	NewNum  int
+	OldURL  template.URL
+	NewURL  template.URL
+	Content template.HTML
+}
+
+// diffSplitRow is a row of the split view. Either side is nil when a line was
+// only added or only deleted.
+type diffSplitRow struct {
+	Left  *diffRenderLine
+	Right *diffRenderLine
+}
+
+// diffHunk is a `@@` section of a diff rendered for both views.
+type diffHunk struct {
+	// e.g. `@@ -10,7 +10,8 @@`
+	Header string
+	// the enclosing function or heading git found for the hunk
+	Context string
+	// unchanged lines between the previous hunk and this one
+	Skipped int
+	Lines   []*diffRenderLine
+	Rows    []*diffSplitRow
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^(@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@)\s?(.*)$`)
+
+func isDiffView(view string) bool {
+	for _, v := range diffViews {
+		if v == view {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenClass returns the css class chroma uses for a token type when it
+// formats with classes so we can reuse `syntax.css`.
+func tokenClass(typ chroma.TokenType) string {
+	for _, t := range []chroma.TokenType{typ, typ.SubCategory(), typ.Category()} {
+		if cls, ok := chroma.StandardTypes[t]; ok && cls != "" {
+			return cls
+		}
+	}
+	return ""
+}
+
+// highlightLines highlights lines as a single block of code so tokens that
+// span lines are correct and returns the html for each line.
+func highlightLines(lexer chroma.Lexer, lines []string) ([]template.HTML, error) {
+	out := make([]template.HTML, len(lines))
+	if len(lines) == 0 {
+		return out, nil
+	}
+
+	iterator, err := lexer.Tokenise(nil, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return nil, err
+	}
+
+	for i, tokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		if i >= len(out) {
+			break
+		}
+
+		var sb strings.Builder
+		for _, token := range tokens {
+			value := html.EscapeString(strings.TrimSuffix(token.Value, "\n"))
+			if value == "" {
+				continue
+			}
+			cls := tokenClass(token.Type)
+			if cls == "" {
+				sb.WriteString(value)
+				continue
+			}
+			sb.WriteString(fmt.Sprintf(`<span class="%s">%s</span>`, cls, value))
+		}
+		out[i] = template.HTML(sb.String())
+	}
+	return out, nil
+}
+
+// isFileMode reports whether an entry is a regular file we can write a page
+// for, symlinks and submodules have no lines to link to.
+func isFileMode(mode git.EntryMode) bool {
+	return mode == git.EntryBlob || mode == git.EntryExec
+}
+
+// lineURL links to a line of the file page for one side of the diff.
+func lineURL(fileURL template.URL, num, maxLines int) template.URL {
+	// pages of longer files stop at `--max-file-lines`
+	if fileURL == "" || num == 0 || (maxLines > 0 && num > maxLines) {
+		return ""
+	}
+	return template.URL(fmt.Sprintf("%s#%d", fileURL, num))
+}
+
+// renderHunks highlights every hunk of a file for the unified and split
+// views. Line numbers link to the file at the parent commit (`oldURL`) and at
+// the commit (`newURL`) when those pages exist and show the line.
+func renderHunks(file *git.DiffFile, oldURL, newURL template.URL, maxLines int) ([]*diffHunk, error) {
+	var text strings.Builder
+	for _, section := range file.Sections {
+		for _, line := range section.Lines {
+			if line.Type != git.DiffLineSection {
+				text.WriteString(line.Content[1:] + "\n")
+			}
+		}
+	}
+	lexer := getLexer(file.Name, text.String())
+
+	hunks := []*diffHunk{}
+	// last line of the previous hunk on the old side
+	prevEnd := 0
+	for _, section := range file.Sections {
+		hunk := &diffHunk{}
+		oldLines := []string{}
+		newLines := []string{}
+		for _, line := range section.Lines {
+			switch line.Type {
+			case git.DiffLineSection:
+				match := hunkHeaderRe.FindStringSubmatch(line.Content)
+				if match == nil {
+					hunk.Header = line.Content
+					continue
+				}
+				hunk.Header = match[1]
+				hunk.Context = match[4]
+				start, _ := strconv.Atoi(match[2])
+				count := 1
+				if match[3] != "" {
+					count, _ = strconv.Atoi(match[3])
+				}
+				// an empty range points at the line before it
+				if count == 0 {
+					start += 1
+				}
+				hunk.Skipped = max(start-prevEnd-1, 0)
+				prevEnd = start + count - 1
+			case git.DiffLinePlain:
+				oldLines = append(oldLines, line.Content[1:])
+				newLines = append(newLines, line.Content[1:])
+			case git.DiffLineDelete:
+				oldLines = append(oldLines, line.Content[1:])
+			case git.DiffLineAdd:
+				newLines = append(newLines, line.Content[1:])
+			}
+		}
+
+		oldHTML, err := highlightLines(lexer, oldLines)
+		if err != nil {
+			return nil, err
+		}
+		newHTML, err := highlightLines(lexer, newLines)
+		if err != nil {
+			return nil, err
+		}
+
+		var dels, adds []*diffRenderLine
+		// pairs the deleted lines with the added lines that replaced them
+		flush := func() {
+			for i := 0; i < max(len(dels), len(adds)); i++ {
+				row := &diffSplitRow{}
+				if i < len(dels) {
+					row.Left = dels[i]
+				}
+				if i < len(adds) {
+					row.Right = adds[i]
+				}
+				hunk.Rows = append(hunk.Rows, row)
+			}
+			hunk.Lines = append(hunk.Lines, dels...)
+			hunk.Lines = append(hunk.Lines, adds...)
+			dels = nil
+			adds = nil
+		}
+
+		oi, ni := 0, 0
+		for _, line := range section.Lines {
+			switch line.Type {
+			case git.DiffLinePlain:
+				flush()
+				left := &diffRenderLine{
+					Type:    "ctx",
+					OldNum:  line.LeftLine,
+					NewNum:  line.RightLine,
+					OldURL:  lineURL(oldURL, line.LeftLine, maxLines),
+					NewURL:  lineURL(newURL, line.RightLine, maxLines),
+					Content: oldHTML[oi],
+				}
+				right := *left
+				right.Content = newHTML[ni]
+				hunk.Lines = append(hunk.Lines, &right)
+				hunk.Rows = append(hunk.Rows, &diffSplitRow{Left: left, Right: &right})
+				oi++
+				ni++
+			case git.DiffLineDelete:
+				dels = append(dels, &diffRenderLine{
+					Type:    "del",
+					OldNum:  line.LeftLine,
+					OldURL:  lineURL(oldURL, line.LeftLine, maxLines),
+					Content: oldHTML[oi],
+				})
+				oi++
+			case git.DiffLineAdd:
+				adds = append(adds, &diffRenderLine{
+					Type:    "add",
+					NewNum:  line.RightLine,
+					NewURL:  lineURL(newURL, line.RightLine, maxLines),
+					Content: newHTML[ni],
+				})
+				ni++
+			}
+		}
+		flush()
+
+		hunks = append(hunks, hunk)
+	}
+
+	return hunks, nil
+}
+
+// combinedDiff highlights the combined diff of a merge commit, it only shows
+// files that differ from every parent which is where conflicts were resolved.
+// It is cut at the same limits as the diff against the first parent.
+func (c *config) combinedDiff(repo *git.Repository, commitID string) (string, bool, error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stderr := new(bytes.Buffer)
+		err := git.NewCommand("show", "--cc", "--format=", commitID).RunInDirPipeline(pw, stderr, repo.Path())
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, stderr.String())
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	out, truncated, err := c.truncateCombined(pr)
+	// git stops once it cannot write the rest of the diff
+	_ = pr.Close()
+	<-done
+	if err != nil {
+		return "", false, err
+	}
+	if strings.TrimSpace(out) == "" {
+		return "", false, nil
+	}
+
+	html, err := c.parseText("combined.diff", out)
+	return html, truncated, err
+}
+
+type commitFilePageData struct {
+	*pageData
+	Path      string
+	CommitID  string
+	ShortID   string
+	CommitURL template.URL
+	Contents  template.HTML
+	NumLines  int
+	// set when only the first lines of the file are shown
+	ShownLines int
+}
+
+// controls the url for a file at a commit, these are what the line numbers in
+// a diff link to
+// - /commits/{commitID}/{path}.html.
+func (c *config) getCommitFileURL(commitID, fpath string) template.URL {
+	return c.compileURL(filepath.Join("/", "commits", commitID), fmt.Sprintf("%s.html", fpath))
+}
+
+// writeCommitFile writes a page with the contents of a file at a commit and
+// returns its url, files over `--max-file-size` get no page. Diffs of
+// neighbouring commits link to the same pages so each is written once.
+func (c *config) writeCommitFile(repo *git.Repository, pageData *pageData, commitID, fpath string) (template.URL, error) {
+	commit, err := repo.CatFileCommit(commitID)
+	if err != nil {
+		return "", err
+	}
+	blob, err := commit.Blob(fpath)
+	if err != nil {
+		return "", err
+	}
+	if c.isTooLarge(blob.Size()) {
+		return "", nil
+	}
+
+	url := c.getCommitFileURL(commitID, fpath)
+	key := fmt.Sprintf("%s:%s", commitID, fpath)
+	if !c.Cache.claim(key) {
+		return url, nil
+	}
+
+	b, err := blob.Bytes()
+	if err != nil {
+		return "", err
+	}
+
+	str := string(b)
+	text, truncated := c.truncateLines(str)
+	shownLines := 0
+	if truncated {
+		shownLines = c.MaxFileLines
+	}
+	contents, err := c.parseText(filepath.Base(fpath), text)
+	if err != nil {
+		return "", err
+	}
+
+	return url, c.writeHtml(&writeData{
+		Filename: fmt.Sprintf("%s.html", filepath.Base(fpath)),
+		Template: "commitfile.page.tmpl",
+		Subdir:   filepath.Join("commits", commitID, filepath.Dir(fpath)),
+		Data: &commitFilePageData{
+			pageData:   pageData,
+			Path:       fpath,
+			CommitID:   commitID,
+			ShortID:    getShortID(commitID),
+			CommitURL:  c.getCommitURL(commitID),
+			Contents:   template.HTML(contents),
+			NumLines:   len(strings.Split(str, "\n")),
+			ShownLines: shownLines,
+		},
+	})
+}
+
+func (c *config) getPatchURL(commitID string) template.URL {
+	return c.compileURL("/commits", fmt.Sprintf("%s.patch", commitID))
+}
+
+// writePatch streams the full diff of a commit, which is what we link to when
+// a diff is too large to show. `base` is the empty tree for a root commit.
+func (c *config) writePatch(repo *git.Repository, commitID, base string) error {
+	if base == "" {
+		base = commitID + "^"
+	}
+
+	fp := filepath.Join(c.Outdir, "commits", fmt.Sprintf("%s.patch", commitID))
+	err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	c.Logger.Info("writing", "filepath", fp)
+	f, err := os.Create(fp)
+	if err != nil {
+		return err
+	}
+
+	stderr := new(bytes.Buffer)
+	err = git.NewCommand("diff", "--full-index", "-M", base, commitID).RunInDirPipeline(f, stderr, repo.Path())
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return f.Close()
+}
@@ -0,0 +1,37 @@
+// Package pgit generates a static site for git repos: a commit log, a page
+// for every commit, file and tree of the revisions you pick, refs, releases
+// and feeds.
+//
+// The pgit command is a thin wrapper over this package, tools can embed it
+// with the same settings:
+//
+//	generator, err := pgit.NewGenerator(pgit.Options{
+//		RepoPath: "./pgit",
+//		Outdir:   "./public",
+//		Revs:     []string{"main"},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	report, err := generator.Generate()
+//	if err != nil {
+//		return err
+//	}
+//	for _, page := range report.Rendered {
+//		fmt.Println(page)
+//	}
+//
+// [BuildReport.Rendered] only lists the html pages the build rendered, pages
+// an earlier build wrote that did not change are skipped unless
+// [Options.Force] is set. The skipped pages stay in [Options.Outdir] and the
+// pgit-manifest.json file there records the commits, revs and files every
+// page of the site was rendered from, walk the output directory for the whole
+// site.
+//
+// A page that fails to render is skipped and listed in [BuildReport.Errors]
+// unless [Options.FailFast] is set.
+//
+// Templates passed with [Options.TemplatesDir] get the same page data as the
+// embedded ones, its fields are documented by the templates in the html
+// directory rather than by this package.
+package pgit
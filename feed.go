@@ -0,0 +1,141 @@
+package pgit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maximum number of entries in a feed.
+const feedSize = 100
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Links   []*atomLink  `xml:"link"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  *atomPerson `xml:"author"`
+	Links   []*atomLink `xml:"link"`
+	Content *atomText   `xml:"content"`
+}
+
+// absURL resolves a site url against the absolute base url. Feeds require
+// absolute links which `RootRelative` cannot provide.
+func (c *config) absURL(u template.URL) (string, error) {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(string(u))
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (c *config) writeFeed(subdir, filename string, feed *atomFeed) error {
+	dir := filepath.Join(c.Outdir, subdir)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	fp := filepath.Join(dir, filename)
+	c.Logger.Info("writing", "filepath", fp)
+
+	b, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fp, append([]byte(xml.Header), b...), 0644)
+}
+
+// writeLogFeed writes an atom feed of the commits in a revision. Feeds are
+// only generated when `BaseURL` is set.
+func (c *config) writeLogFeed(data *pageData, logs []*commitData, subdir string) error {
+	if c.BaseURL == "" {
+		return nil
+	}
+
+	c.Logger.Info("writing log feed", "revision", data.RevData.Name(), "subdir", subdir)
+	feedURL, err := c.absURL(c.compileURL(subdir, "atom.xml"))
+	if err != nil {
+		return err
+	}
+	logURL, err := c.absURL(data.RevData.LogURL())
+	if err != nil {
+		return err
+	}
+
+	feed := &atomFeed{
+		Title: fmt.Sprintf("%s commits (%s)", c.RepoName, data.RevData.Name()),
+		ID:    feedURL,
+		Links: []*atomLink{
+			{Href: feedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: logURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for i, commit := range logs {
+		if i >= feedSize {
+			break
+		}
+		if i == 0 {
+			feed.Updated = atomTime(commit.Committer.When)
+		}
+
+		commitURL, err := c.absURL(commit.URL)
+		if err != nil {
+			return err
+		}
+		feed.Entries = append(feed.Entries, &atomEntry{
+			Title:   commit.SummaryStr,
+			ID:      commitURL,
+			Updated: atomTime(commit.Committer.When),
+			Author: &atomPerson{
+				Name:  commit.Author.Name,
+				Email: commit.Author.Email,
+			},
+			Links:   []*atomLink{{Href: commitURL, Rel: "alternate", Type: "text/html"}},
+			Content: &atomText{Type: "text", Body: commit.Message},
+		})
+	}
+
+	if feed.Updated == "" {
+		feed.Updated = atomTime(time.Now())
+	}
+
+	return c.writeFeed(subdir, "atom.xml", feed)
+}
@@ -0,0 +1,290 @@
+package pgit
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	formatterHtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	git "github.com/gogs/git-module"
+)
+
+// defaults for the options left empty
+const (
+	DefaultOutdir       = "./public"
+	DefaultTheme        = "dracula"
+	DefaultRootRelative = "/"
+	DefaultLogPageSize  = 100
+)
+
+// Options configures a Generator. Every field is optional, the zero value
+// builds the site for HEAD of the repo in the current directory.
+type Options struct {
+	// output directory, default is ./public
+	Outdir string
+	// path to the git repo, default is the current directory
+	RepoPath string
+	// builds every repo into its own subdir with an index page when set,
+	// RepoPath is ignored
+	Repos []*RepoEntry
+	// pretty name for the repo, default is the last folder in RepoPath or
+	// "repos" for a multi-repo site
+	Label string
+
+	// revs to generate logs and trees for, default is HEAD
+	Revs []string
+	// description of the repo, or of the index page of a multi-repo site
+	Desc string
+	// name of the readme file shown on the summary page, default is README.md
+	Readme string
+	// chroma theme, default is dracula
+	Theme string
+	// the settings above are the defaults for a repo and its `.pgit.toml`
+	// can change them, settings here always win
+	Override RepoConfig
+
+	// git clone url for upstream
+	CloneURL string
+	// url for breadcrumbs to go to the root page, hidden if empty
+	HomeURL string
+	// html root relative, default is /
+	RootRelative string
+	// absolute url of the site root used for atom feeds, feeds are skipped if
+	// empty
+	BaseURL string
+
+	// maximum number of commits to generate, -1 generates every commit
+	MaxCommits int
+	// number of commits on each page of the log, default is 100
+	LogPageSize int
+	// files over this many bytes are not highlighted, 0 means no limit
+	MaxFileSize int64
+	// only the first lines of longer files are highlighted, 0 means no limit
+	MaxFileLines int
+	// only the first lines of a larger diff of a file are shown, 0 means no
+	// limit
+	MaxDiffLines int
+	// only the first files of a larger diff of a commit are shown, 0 means no
+	// limit
+	MaxDiffFiles int
+	// number of pages rendered at once, default is the number of CPUs
+	Jobs int
+
+	// dont calculate the last commit for each file in the tree
+	HideTreeLastCommit bool
+	// cache the last commit of every file between builds
+	LastCommitCache bool
+	// dont write a history page for every file and directory, the last commit
+	// lookup can then stop early and use its cache
+	NoHistory bool
+	// generate a blame page for every text file
+	Blame bool
+	// default view for diffs on commit pages, unified or split
+	DiffView string
+	// also show the combined diff on merge commit pages
+	CombinedDiff bool
+	// write every changed file before and after a commit so line numbers in
+	// its diff link to them
+	CommitFiles bool
+	// write tar.gz and zip archives of every rev
+	Archives bool
+	// with Archives also write archives of every tag
+	ArchiveTags bool
+	// add the contents of text files to the search index
+	SearchCode bool
+
+	// directory of templates that replace the embedded ones with the same name
+	TemplatesDir string
+	// directory of assets copied over the embedded ones
+	StaticDir string
+
+	// ignore the manifest of previous builds and regenerate every page
+	Force bool
+	// stop at the first page that fails instead of skipping it
+	FailFast bool
+
+	// default is slog.Default()
+	Logger *slog.Logger
+}
+
+// Generator builds a static site for one or more git repos.
+type Generator struct {
+	opts      Options
+	templates map[string]*template.Template
+}
+
+// NewGenerator checks the options and parses the templates so a mistake is
+// reported before anything is written.
+func NewGenerator(opts Options) (*Generator, error) {
+	if opts.Outdir == "" {
+		opts.Outdir = DefaultOutdir
+	}
+	if opts.RepoPath == "" {
+		opts.RepoPath = "."
+	}
+	if opts.Theme == "" {
+		opts.Theme = DefaultTheme
+	}
+	if opts.RootRelative == "" {
+		opts.RootRelative = DefaultRootRelative
+	}
+	if opts.LogPageSize <= 0 {
+		opts.LogPageSize = DefaultLogPageSize
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+	if opts.DiffView == "" {
+		opts.DiffView = diffViews[0]
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	var err error
+	opts.Outdir, err = filepath.Abs(opts.Outdir)
+	if err != nil {
+		return nil, err
+	}
+	opts.RepoPath, err = filepath.Abs(opts.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	opts.TemplatesDir, err = absDir("templates", opts.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	opts.StaticDir, err = absDir("static", opts.StaticDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Label == "" {
+		opts.Label = repoName(opts.RepoPath)
+		if len(opts.Repos) > 0 {
+			opts.Label = "repos"
+		}
+	}
+	if len(opts.Revs) == 0 {
+		opts.Revs = []string{"HEAD"}
+	}
+
+	if !isDiffView(opts.DiffView) {
+		return nil, fmt.Errorf("diff view must be one of %s", strings.Join(diffViews, ", "))
+	}
+
+	g := &Generator{opts: opts}
+	config := g.newConfig()
+	err = config.parseTemplates()
+	if err != nil {
+		return nil, err
+	}
+	g.templates = config.Templates
+	return g, nil
+}
+
+// newConfig creates the config of a single build.
+func (g *Generator) newConfig() *config {
+	opts := g.opts
+	revs := opts.Revs
+	if len(opts.Override.Revs) > 0 {
+		revs = opts.Override.Revs
+	}
+
+	// settings the repo is not allowed to change
+	setFlags := map[string]bool{
+		"desc":   opts.Override.Desc != "",
+		"readme": opts.Override.Readme != "",
+		"theme":  opts.Override.Theme != "",
+		"revs":   len(opts.Override.Revs) > 0,
+	}
+
+	c := &config{
+		Outdir:             opts.Outdir,
+		RepoPath:           opts.RepoPath,
+		RepoName:           opts.Label,
+		Cache:              newPageCache(),
+		Revs:               revs,
+		Logger:             opts.Logger,
+		CloneURL:           template.URL(opts.CloneURL),
+		HomeURL:            template.URL(opts.HomeURL),
+		Desc:               cmp.Or(opts.Override.Desc, opts.Desc),
+		Readme:             cmp.Or(opts.Override.Readme, opts.Readme),
+		MaxCommits:         opts.MaxCommits,
+		LogPageSize:        opts.LogPageSize,
+		MaxFileSize:        opts.MaxFileSize,
+		MaxFileLines:       opts.MaxFileLines,
+		MaxDiffLines:       opts.MaxDiffLines,
+		MaxDiffFiles:       opts.MaxDiffFiles,
+		HideTreeLastCommit: opts.HideTreeLastCommit,
+		LastCommitCache:    opts.LastCommitCache,
+		NoHistory:          opts.NoHistory,
+		Blame:              opts.Blame,
+		SearchCode:         opts.SearchCode,
+		DiffView:           opts.DiffView,
+		CombinedDiff:       opts.CombinedDiff,
+		CommitFiles:        opts.CommitFiles,
+		Archives:           opts.Archives,
+		ArchiveTags:        opts.ArchiveTags,
+		TemplatesDir:       opts.TemplatesDir,
+		StaticDir:          opts.StaticDir,
+		Templates:          g.templates,
+		Force:              opts.Force,
+		FailFast:           opts.FailFast,
+		RootRelative:       opts.RootRelative,
+		BaseURL:            opts.BaseURL,
+		AssetRoot:          opts.RootRelative,
+		Report:             &BuildReport{},
+		Pool:               newWorkerPool(opts.Jobs, opts.Logger),
+		SetFlags:           setFlags,
+	}
+	c.Theme = styles.Get(cmp.Or(opts.Override.Theme, opts.Theme))
+	c.Formatter = formatterHtml.New(
+		formatterHtml.WithLineNumbers(true),
+		formatterHtml.WithLinkableLineNumbers(true, ""),
+		formatterHtml.WithClasses(true),
+	)
+	c.Markdown = newMarkdown(c.Theme)
+	c.Sanitizer = newSanitizer()
+	return c
+}
+
+// Generate builds the site into the output directory. Pages that fail are
+// skipped and listed in the report unless FailFast is set, the error is only
+// returned when the build could not finish.
+func (g *Generator) Generate() (*BuildReport, error) {
+	config := g.newConfig()
+	config.Logger.Info("config", "config", config)
+
+	var err error
+	if len(g.opts.Repos) > 0 {
+		err = config.writeRepos(g.opts.Repos)
+	} else {
+		var repo *git.Repository
+		repo, err = git.Open(config.RepoPath)
+		if err == nil {
+			err = config.reportErr(config.loadRepoConfig(repo), "", repoConfigFilename)
+		}
+		if err == nil {
+			_, err = config.writeRepo()
+		}
+	}
+	if err != nil {
+		return config.Report, err
+	}
+
+	err = config.writeAssets()
+	if err != nil {
+		return config.Report, err
+	}
+
+	config.Pool.report()
+	sort.Strings(config.Report.Rendered)
+	return config.Report, nil
+}
@@ -0,0 +1,83 @@
+package pgit
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGit runs git in dir with a fixed identity and returns its output.
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	return testGitEnv(t, dir, nil, args...)
+}
+
+func testGitEnv(t *testing.T, dir string, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(
+		append(os.Environ(), env...),
+		"GIT_AUTHOR_NAME=pgit",
+		"GIT_AUTHOR_EMAIL=pgit@example.com",
+		"GIT_COMMITTER_NAME=pgit",
+		"GIT_COMMITTER_EMAIL=pgit@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// testRepo creates an empty repo on the main branch.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	testGit(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
+
+// testCommit writes files and commits them one day after the previous
+// commit so dates sort the same as history.
+func testCommit(t *testing.T, dir string, day int, msg string, files map[string]string) string {
+	t.Helper()
+	for fpath, content := range files {
+		fp := filepath.Join(dir, fpath)
+		err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(fp, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	date := time.Date(2024, 1, day, 12, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	testGit(t, dir, "add", "-A")
+	testGitEnv(
+		t, dir,
+		[]string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date},
+		"commit", "-q", "--allow-empty", "-m", msg,
+	)
+	return testGit(t, dir, "rev-parse", "HEAD")
+}
+
+// testConfig is enough of a config to call the helpers that read a repo.
+func testConfig(t *testing.T) *config {
+	t.Helper()
+	return &config{
+		Outdir:       t.TempDir(),
+		RootRelative: "/",
+		Cache:        newPageCache(),
+		Report:       &BuildReport{},
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
@@ -0,0 +1,164 @@
+package pgit
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+
+	git "github.com/gogs/git-module"
+)
+
+type historyPageData struct {
+	*pageData
+	Item *treeItem
+	Logs []*commitData
+}
+
+func getHistoryBaseDir(info revInfo) string {
+	return filepath.Join(getTreeBaseDir(info), "history")
+}
+
+// controls the url for history pages
+// - /tree/getRevIDForURL()/history/dir/index.html
+// - /tree/getRevIDForURL()/history/dir/file.x.html.
+func getHistoryFile(fpath string, isDir bool) (string, string) {
+	if isDir {
+		return fpath, "index.html"
+	}
+	return filepath.Dir(fpath), fmt.Sprintf("%s.html", filepath.Base(fpath))
+}
+
+func (c *config) getHistoryURL(info revInfo, fpath string, isDir bool) template.URL {
+	dir, fname := getHistoryFile(fpath, isDir)
+	return c.compileURL(filepath.Join(getHistoryBaseDir(info), dir), fname)
+}
+
+// revHistory lists the commits that touched every path in a rev, newest
+// first.
+type revHistory struct {
+	Commits map[string]*lastCommit
+	// path -> commit ids
+	Paths map[string][]string
+}
+
+func (h *revHistory) add(fpath string, commit *lastCommit, maxCommits int) {
+	ids := h.Paths[fpath]
+	if maxCommits > 0 && len(ids) >= maxCommits {
+		return
+	}
+	// a commit can touch a directory through several of its files
+	if len(ids) > 0 && ids[len(ids)-1] == commit.ID {
+		return
+	}
+	h.Paths[fpath] = append(ids, commit.ID)
+	h.Commits[commit.ID] = commit
+}
+
+// lastCommits takes the newest commit of every path so the tree does not need
+// another pass over the history.
+func (h *revHistory) lastCommits(revID string) *revLastCommits {
+	lc := newRevLastCommits(revID)
+	for fpath, ids := range h.Paths {
+		lc.Paths[fpath] = ids[0]
+		lc.Commits[ids[0]] = h.Commits[ids[0]]
+	}
+	return lc
+}
+
+// walkHistory reads the history of a rev once and records the commits that
+// touched each of the paths we are looking for and their parent directories.
+// Files follow renames the way `git log --follow` does, directories do not.
+func walkHistory(repo *git.Repository, revID string, paths map[string]bool, maxCommits int) (*revHistory, error) {
+	history := &revHistory{
+		Commits: map[string]*lastCommit{},
+		Paths:   map[string][]string{},
+	}
+	// older name of a file -> its path in the rev
+	follow := map[string]string{}
+
+	err := walkLog(repo, []string{"-M", revID}, func(commit *lastCommit, change *logChange) error {
+		for _, fpath := range parentDirs(change.Path) {
+			if paths[fpath] {
+				history.add(fpath, commit, maxCommits)
+			}
+		}
+		current, renamed := follow[change.Path]
+		if renamed {
+			history.add(current, commit, maxCommits)
+		}
+
+		if change.From == "" {
+			return nil
+		}
+		// the directories the file was moved out of changed too
+		for _, fpath := range parentDirs(change.From) {
+			if paths[fpath] {
+				history.add(fpath, commit, maxCommits)
+			}
+		}
+		if paths[change.Path] {
+			follow[change.From] = change.Path
+		} else if renamed {
+			follow[change.From] = current
+		}
+		return nil
+	})
+	return history, err
+}
+
+// revHistory finds the history of every path in a rev. It replaces the
+// last commit lookup since the newest commit of each path comes with it.
+func (c *config) revHistory(repo *git.Repository, info revInfo) (*revHistory, error) {
+	paths, err := treePaths(repo, info.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := walkHistory(repo, info.ID(), paths, c.getMaxCommits())
+	if err != nil {
+		return nil, err
+	}
+
+	c.LastCommits.mu.Lock()
+	c.LastCommits.Revs[info.Name()] = history.lastCommits(info.ID())
+	c.LastCommits.mu.Unlock()
+	return history, nil
+}
+
+// writeHistory writes a page listing every commit that touched a file or
+// directory.
+func (c *config) writeHistory(repo *git.Repository, pageData *pageData, treeItem *treeItem, history *revHistory) error {
+	logs := []*commitData{}
+	for _, id := range history.Paths[treeItem.Path] {
+		commit, err := history.Commits[id].gitCommit()
+		if err != nil {
+			return err
+		}
+		logs = append(logs, c.newCommitData(commit, nil))
+	}
+
+	dir, fname := getHistoryFile(treeItem.Path, treeItem.IsDir)
+	err := c.writeHtml(&writeData{
+		Filename: fname,
+		Template: "history.page.tmpl",
+		Subdir:   filepath.Join(getHistoryBaseDir(pageData.RevData), dir),
+		Data: &historyPageData{
+			pageData: pageData,
+			Item:     treeItem,
+			Logs:     logs,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// the history of a file can go back further than the log
+	for _, id := range history.Paths[treeItem.Path] {
+		err = c.writeLinkedCommit(repo, pageData, id)
+		err = c.reportErr(err, id, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
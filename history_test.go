@@ -0,0 +1,95 @@
+package pgit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	git "github.com/gogs/git-module"
+)
+
+func TestWalkHistory(t *testing.T) {
+	dir := testRepo(t)
+	first := testCommit(t, dir, 1, "first", map[string]string{
+		"src/a.go":  "package a\n",
+		"README.md": "# readme\n",
+	})
+	second := testCommit(t, dir, 2, "second", map[string]string{"src/a.go": "package a\n\nvar A = 1\n"})
+	err := os.MkdirAll(filepath.Join(dir, "src", "pkg"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGit(t, dir, "mv", "src/a.go", "src/pkg/b.go")
+	renamed := testCommit(t, dir, 3, "rename", nil)
+	readme := testCommit(t, dir, 4, "readme", map[string]string{"README.md": "# pgit\n"})
+
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := treePaths(repo, readme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := walkHistory(repo, readme, paths, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		// files follow renames
+		{"src/pkg/b.go", []string{renamed, second, first}},
+		{"README.md", []string{readme, first}},
+		// directories only list the commits that touched them by that name
+		{"src", []string{renamed, second, first}},
+		{"src/pkg", []string{renamed}},
+	}
+	for _, tt := range tests {
+		got := history.Paths[tt.path]
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	last := history.lastCommits(readme)
+	if got := last.get("src").ID; got != renamed {
+		t.Errorf("last commit of src: got %s, want %s", got, renamed)
+	}
+	if got := history.Commits[second].Message; got != "second\n" {
+		t.Errorf("message: got %q", got)
+	}
+
+	capped, err := walkHistory(repo, readme, paths, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := capped.Paths["src/pkg/b.go"]; !reflect.DeepEqual(got, []string{renamed}) {
+		t.Errorf("capped history: got %v", got)
+	}
+}
+
+// Commits listed on a history page get a commit page even when they are
+// older than the log.
+func TestHistoryCommitPages(t *testing.T) {
+	dir := testRepo(t)
+	first := testCommit(t, dir, 1, "first", map[string]string{"a.txt": "a\n"})
+	testCommit(t, dir, 2, "second", map[string]string{"b.txt": "b\n"})
+	outdir := t.TempDir()
+
+	report := testBuildOpts(t, Options{
+		RepoPath:    dir,
+		Outdir:      outdir,
+		MaxCommits:  1,
+		LogPageSize: 1,
+	})
+	if report.HasErrors() {
+		t.Fatal(report.Errors)
+	}
+	if !fileExists(filepath.Join(outdir, "commits", first+".html")) {
+		t.Fatal("commit linked from the history page was not written")
+	}
+}
@@ -0,0 +1,393 @@
+package pgit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	git "github.com/gogs/git-module"
+)
+
+const lastCommitsFilename = "pgit-lastcommits.json"
+
+// separates commits and the fields of a commit in the `git log` we parse
+const (
+	logRecordSep = "\x1e"
+	logFieldSep  = "\x1f"
+)
+
+// reading the whole history of a large repo can take longer than the default
+// timeout of a `git` command
+const lastCommitsTimeout = time.Hour
+
+// errLogDone stops reading the log once every path has its last commit.
+var errLogDone = errors.New("found the last commit of every path")
+
+// lastCommit is the commit that last touched a path.
+type lastCommit struct {
+	ID      string    `json:"id"`
+	Summary string    `json:"summary"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email"`
+	When    time.Time `json:"when"`
+	// only read for history pages, the cache does not need it
+	Message string `json:"-"`
+}
+
+// revLastCommits maps every path in a rev to the commit that last touched it.
+type revLastCommits struct {
+	// the rev these were computed for
+	ID      string                 `json:"id"`
+	Commits map[string]*lastCommit `json:"commits"`
+	// path -> commit id
+	Paths map[string]string `json:"paths"`
+}
+
+func newRevLastCommits(revID string) *revLastCommits {
+	return &revLastCommits{
+		ID:      revID,
+		Commits: map[string]*lastCommit{},
+		Paths:   map[string]string{},
+	}
+}
+
+// gitCommit converts the commit for the helpers that render a *git.Commit,
+// it does not know its parents.
+func (lc *lastCommit) gitCommit() (*git.Commit, error) {
+	id, err := git.NewIDFromString(lc.ID)
+	if err != nil {
+		return nil, err
+	}
+	sig := &git.Signature{
+		Name:  lc.Author,
+		Email: lc.Email,
+		When:  lc.When,
+	}
+	return &git.Commit{
+		ID:        id,
+		Author:    sig,
+		Committer: sig,
+		Message:   lc.Message,
+	}, nil
+}
+
+func (r *revLastCommits) get(fpath string) *lastCommit {
+	return r.Commits[r.Paths[fpath]]
+}
+
+// lastCommitCache keeps the last commits of every rev between builds so a new
+// build only reads the history since the previous one.
+type lastCommitCache struct {
+	mu   sync.Mutex
+	Revs map[string]*revLastCommits `json:"revs"`
+}
+
+func (c *config) lastCommitsPath() string {
+	return filepath.Join(c.Outdir, lastCommitsFilename)
+}
+
+// loadLastCommitCache reads the cache of the previous build when
+// `--last-commit-cache` is set.
+func (c *config) loadLastCommitCache() (*lastCommitCache, error) {
+	cache := &lastCommitCache{Revs: map[string]*revLastCommits{}}
+	if !c.LastCommitCache || c.Force {
+		return cache, nil
+	}
+
+	b, err := os.ReadFile(c.lastCommitsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, cache)
+	if err != nil {
+		c.Logger.Error("could not parse last commit cache, rebuilding", "err", err)
+		return &lastCommitCache{Revs: map[string]*revLastCommits{}}, nil
+	}
+	return cache, nil
+}
+
+func (c *config) saveLastCommitCache() error {
+	if !c.LastCommitCache {
+		return nil
+	}
+
+	c.LastCommits.mu.Lock()
+	defer c.LastCommits.mu.Unlock()
+	b, err := json.Marshal(c.LastCommits)
+	if err != nil {
+		return err
+	}
+	c.Logger.Info("writing", "filepath", c.lastCommitsPath())
+	return os.WriteFile(c.lastCommitsPath(), b, 0644)
+}
+
+// treePaths lists every file, directory and submodule in a rev.
+func treePaths(repo *git.Repository, revID string) (map[string]bool, error) {
+	out, err := git.NewCommand("ls-tree", "-r", "-t", "-z", "--name-only", revID).RunInDir(repo.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]bool{}
+	for _, fpath := range strings.Split(string(out), "\x00") {
+		if fpath != "" {
+			paths[fpath] = true
+		}
+	}
+	return paths, nil
+}
+
+// the format of every commit in the `git log` we parse
+var logFormat = "--format=" + logRecordSep + strings.Join(
+	[]string{"%H", "%an", "%ae", "%at", "%s", "%B"},
+	logFieldSep,
+)
+
+// parseLogCommit parses a commit formatted by `logFormat`.
+func parseLogCommit(header string) (*lastCommit, error) {
+	fields := strings.SplitN(header, logFieldSep, 6)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("malformed log entry: %q", header)
+	}
+	ts, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &lastCommit{
+		ID:      fields[0],
+		Author:  fields[1],
+		Email:   fields[2],
+		When:    time.Unix(ts, 0),
+		Summary: fields[4],
+		Message: fields[5],
+	}, nil
+}
+
+// logChange is a path changed by a commit, From is set when git detected the
+// path was renamed or copied from another one.
+type logChange struct {
+	Path string
+	From string
+}
+
+// logParser reads the output of `git log -z --name-status` one NUL separated
+// token at a time: a commit header followed by a status and one path, or two
+// paths for renames and copies.
+type logParser struct {
+	reader *bufio.Reader
+	commit *lastCommit
+}
+
+// next returns the next change along with the commit it belongs to.
+func (p *logParser) next() (*lastCommit, *logChange, error) {
+	for {
+		token, err := p.token()
+		if err != nil {
+			return nil, nil, err
+		}
+		// git separates the header from the changes with a newline
+		token = strings.TrimPrefix(token, "\n")
+		if token == "" {
+			continue
+		}
+
+		if strings.HasPrefix(token, logRecordSep) {
+			p.commit, err = parseLogCommit(strings.TrimPrefix(token, logRecordSep))
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if p.commit == nil {
+			return nil, nil, fmt.Errorf("change before the first commit: %q", token)
+		}
+
+		// the token is a status like `M`, `A` or `R100`
+		fpath, err := p.path()
+		if err != nil {
+			return nil, nil, err
+		}
+		change := &logChange{Path: fpath}
+		if token[0] == 'R' || token[0] == 'C' {
+			change.From = fpath
+			change.Path, err = p.path()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		return p.commit, change, nil
+	}
+}
+
+// path reads a path of a change, the log cannot end before it.
+func (p *logParser) path() (string, error) {
+	fpath, err := p.token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fpath, err
+}
+
+func (p *logParser) token() (string, error) {
+	token, err := p.reader.ReadString(0)
+	if err == io.EOF && token != "" {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(token, "\x00"), nil
+}
+
+// walkLog streams `git log` newest first and calls fn for every path a commit
+// changed. fn returns errLogDone to stop reading early.
+func walkLog(repo *git.Repository, args []string, fn func(*lastCommit, *logChange) error) error {
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		stderr := new(bytes.Buffer)
+		cmd := append([]string{"log", "-z", "--name-status", logFormat}, args...)
+		err := git.NewCommand(cmd...).RunInDirPipelineWithTimeout(lastCommitsTimeout, w, stderr, repo.Path())
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, stderr.String())
+		}
+		_ = w.CloseWithError(err)
+		done <- err
+	}()
+
+	parser := &logParser{reader: bufio.NewReader(r)}
+	var err error
+	for {
+		var commit *lastCommit
+		var change *logChange
+		commit, change, err = parser.next()
+		if err != nil {
+			break
+		}
+		err = fn(commit, change)
+		if err != nil {
+			break
+		}
+	}
+
+	// stop git from writing the rest of the log
+	_ = r.CloseWithError(errLogDone)
+	gitErr := <-done
+	if err == io.EOF || err == errLogDone {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return gitErr
+}
+
+// parentDirs returns a path followed by every directory above it, a change to
+// a file is a change to each of them.
+func parentDirs(fpath string) []string {
+	dirs := []string{}
+	for ; fpath != "." && fpath != "/" && fpath != ""; fpath = filepath.Dir(fpath) {
+		dirs = append(dirs, fpath)
+	}
+	return dirs
+}
+
+// walkLastCommits reads `git log` for a revision range newest first and
+// records the first commit that touched each of the paths we are looking for
+// and their parent directories. It stops reading once every path was found.
+func walkLastCommits(repo *git.Repository, revRange string, paths map[string]bool, lc *revLastCommits) error {
+	remaining := 0
+	for fpath := range paths {
+		if _, ok := lc.Paths[fpath]; !ok {
+			remaining += 1
+		}
+	}
+	if remaining == 0 {
+		return nil
+	}
+
+	args := []string{"--no-renames", revRange}
+	return walkLog(repo, args, func(commit *lastCommit, change *logChange) error {
+		for _, fpath := range parentDirs(change.Path) {
+			if !paths[fpath] {
+				continue
+			}
+			if _, ok := lc.Paths[fpath]; ok {
+				continue
+			}
+			lc.Paths[fpath] = commit.ID
+			lc.Commits[commit.ID] = commit
+			remaining -= 1
+		}
+		if remaining == 0 {
+			return errLogDone
+		}
+		return nil
+	})
+}
+
+// lastCommits finds the last commit of every path in a rev in a single pass
+// over its history. With `--last-commit-cache` only the commits since the
+// previous build are read when the rev moved forward.
+func (c *config) lastCommits(repo *git.Repository, info revInfo) (*revLastCommits, error) {
+	revID := info.ID()
+	paths, err := treePaths(repo, revID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.LastCommits.mu.Lock()
+	prev := c.LastCommits.Revs[info.Name()]
+	c.LastCommits.mu.Unlock()
+
+	lc := newRevLastCommits(revID)
+	if prev != nil && prev.ID == revID {
+		lc = prev
+	} else if prev != nil && isAncestor(repo, prev.ID, revID) {
+		c.Logger.Info("reading history since last build", "revision", info.Name(), "since", getShortID(prev.ID))
+		err = walkLastCommits(repo, prev.ID+".."+revID, paths, lc)
+		if err != nil {
+			return nil, err
+		}
+		// everything untouched since the last build kept its last commit
+		for fpath := range paths {
+			if _, ok := lc.Paths[fpath]; ok {
+				continue
+			}
+			if commit := prev.get(fpath); commit != nil {
+				lc.Paths[fpath] = commit.ID
+				lc.Commits[commit.ID] = commit
+			}
+		}
+	}
+
+	// anything still missing needs the full history
+	err = walkLastCommits(repo, revID, paths, lc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.LastCommits.mu.Lock()
+	c.LastCommits.Revs[info.Name()] = lc
+	c.LastCommits.mu.Unlock()
+	return lc, nil
+}
+
+func isAncestor(repo *git.Repository, ancestor, rev string) bool {
+	_, err := git.NewCommand("merge-base", "--is-ancestor", ancestor, rev).RunInDir(repo.Path())
+	return err == nil
+}
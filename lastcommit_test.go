@@ -0,0 +1,253 @@
+package pgit
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	git "github.com/gogs/git-module"
+)
+
+// logHeader is a commit the way `logFormat` prints it.
+func logHeader(id, summary string) string {
+	fields := []string{id, "pgit", "pgit@example.com", "1704110400", summary, summary + "\n"}
+	return logRecordSep + strings.Join(fields, logFieldSep) + "\x00"
+}
+
+type parsedChange struct {
+	ID   string
+	Path string
+	From string
+}
+
+func parseLog(out string) ([]parsedChange, error) {
+	parser := &logParser{reader: bufio.NewReader(strings.NewReader(out))}
+	changes := []parsedChange{}
+	for {
+		commit, change, err := parser.next()
+		if err == io.EOF {
+			return changes, nil
+		}
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, parsedChange{commit.ID, change.Path, change.From})
+	}
+}
+
+func TestLogParser(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []parsedChange
+		err  bool
+	}{
+		{
+			name: "modify",
+			out:  logHeader("c1", "one") + "\nM\x00a.txt\x00",
+			want: []parsedChange{{"c1", "a.txt", ""}},
+		},
+		{
+			name: "rename and copy",
+			out:  logHeader("c1", "one") + "\nR100\x00old.txt\x00new.txt\x00C075\x00a.go\x00b.go\x00D\x00gone\x00",
+			want: []parsedChange{
+				{"c1", "new.txt", "old.txt"},
+				{"c1", "b.go", "a.go"},
+				{"c1", "gone", ""},
+			},
+		},
+		{
+			name: "commit without changes",
+			out:  logHeader("c2", "two") + "\nA\x00b\x00" + logHeader("c1", "empty") + logHeader("c0", "zero") + "\nA\x00a\x00",
+			want: []parsedChange{{"c2", "b", ""}, {"c0", "a", ""}},
+		},
+		{
+			// -z keeps paths as they are, newlines and all
+			name: "odd paths",
+			out:  logHeader("c1", "one") + "\nA\x00\nodd\nname\x00A\x00with space\x00",
+			want: []parsedChange{{"c1", "\nodd\nname", ""}, {"c1", "with space", ""}},
+		},
+		{
+			name: "empty",
+			out:  "",
+			want: []parsedChange{},
+		},
+		{
+			name: "change before commit",
+			out:  "M\x00a.txt\x00",
+			want: []parsedChange{},
+			err:  true,
+		},
+		{
+			name: "missing path",
+			out:  logHeader("c1", "one") + "\nM\x00a.txt",
+			want: []parsedChange{},
+			err:  true,
+		},
+		{
+			name: "log ends after status",
+			out:  logHeader("c1", "one") + "\nM\x00",
+			want: []parsedChange{},
+			err:  true,
+		},
+		{
+			name: "missing rename target",
+			out:  logHeader("c1", "one") + "\nR100\x00old.txt\x00",
+			want: []parsedChange{},
+			err:  true,
+		},
+		{
+			name: "malformed header",
+			out:  logRecordSep + "c1" + logFieldSep + "pgit\x00",
+			want: []parsedChange{},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseLog(tt.out)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogCommit(t *testing.T) {
+	header := strings.Join([]string{"c1", "pgit", "pgit@example.com", "1704110400", "fix", "fix\n\nbody\x1fwith a separator\n"}, logFieldSep)
+	commit, err := parseLogCommit(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.ID != "c1" || commit.Author != "pgit" || commit.Email != "pgit@example.com" || commit.Summary != "fix" {
+		t.Errorf("got %+v", commit)
+	}
+	if commit.When.Unix() != 1704110400 {
+		t.Errorf("got time %s", commit.When)
+	}
+	// the message is last so it can hold anything
+	if commit.Message != "fix\n\nbody\x1fwith a separator\n" {
+		t.Errorf("got message %q", commit.Message)
+	}
+
+	for _, header := range []string{
+		"c1" + logFieldSep + "pgit",
+		strings.Join([]string{"c1", "pgit", "pgit@example.com", "yesterday", "fix", "fix"}, logFieldSep),
+	} {
+		_, err := parseLogCommit(header)
+		if err == nil {
+			t.Errorf("%q: expected an error", header)
+		}
+	}
+}
+
+func TestParentDirs(t *testing.T) {
+	tests := []struct {
+		fpath string
+		want  []string
+	}{
+		{"a.txt", []string{"a.txt"}},
+		{"src/pkg/b.go", []string{"src/pkg/b.go", "src/pkg", "src"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		got := parentDirs(tt.fpath)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parentDirs(%q): got %v, want %v", tt.fpath, got, tt.want)
+		}
+	}
+}
+
+func TestWalkLastCommits(t *testing.T) {
+	dir := testRepo(t)
+	first := testCommit(t, dir, 1, "first", map[string]string{
+		"a.txt":          "a\n",
+		"src/main.go":    "package main\n",
+		"odd\nname.txt":  "odd\n",
+		"with space.txt": "space\n",
+	})
+	second := testCommit(t, dir, 2, "second", map[string]string{"src/main.go": "package main\n\nfunc main() {}\n"})
+	third := testCommit(t, dir, 3, "third", map[string]string{"with space.txt": "spaces\n"})
+
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := treePaths(repo, third)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lc := newRevLastCommits(third)
+	err = walkLastCommits(repo, third, paths, lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt":          first,
+		"odd\nname.txt":  first,
+		"src":            second,
+		"src/main.go":    second,
+		"with space.txt": third,
+	}
+	if !reflect.DeepEqual(lc.Paths, want) {
+		t.Errorf("got %q, want %q", lc.Paths, want)
+	}
+	if got := lc.get("src").Summary; got != "second" {
+		t.Errorf("summary of src: got %q", got)
+	}
+
+	// paths we already know keep their commit, e.g. from the cache
+	lc = newRevLastCommits(third)
+	lc.Paths["a.txt"] = "cached"
+	err = walkLastCommits(repo, second+".."+third, paths, lc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"a.txt":          "cached",
+		"with space.txt": third,
+	}
+	if !reflect.DeepEqual(lc.Paths, want) {
+		t.Errorf("range: got %q, want %q", lc.Paths, want)
+	}
+}
+
+func TestWalkLogStops(t *testing.T) {
+	dir := testRepo(t)
+	for day := 1; day <= 3; day++ {
+		testCommit(t, dir, day, "commit", map[string]string{"a.txt": strings.Repeat("a", day)})
+	}
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	err = walkLog(repo, []string{"HEAD"}, func(*lastCommit, *logChange) error {
+		calls += 1
+		return errLogDone
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("got %d calls and error %v", calls, err)
+	}
+
+	stop := errors.New("stop")
+	err = walkLog(repo, []string{"HEAD"}, func(*lastCommit, *logChange) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+
+	err = walkLog(repo, []string{"not-a-rev"}, func(*lastCommit, *logChange) error {
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error for a missing rev")
+	}
+}
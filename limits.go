@@ -0,0 +1,155 @@
+package pgit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	git "github.com/gogs/git-module"
+)
+
+// isTooLarge reports whether a file is over `--max-file-size`, those are not
+// loaded into memory or highlighted.
+func (c *config) isTooLarge(size int64) bool {
+	return c.MaxFileSize > 0 && size > c.MaxFileSize
+}
+
+// truncateLines keeps the first `--max-file-lines` lines of text and reports
+// whether any were cut.
+func (c *config) truncateLines(text string) (string, bool) {
+	if c.MaxFileLines <= 0 {
+		return text, false
+	}
+
+	idx := 0
+	for i := 0; i < c.MaxFileLines; i++ {
+		next := strings.IndexByte(text[idx:], '\n')
+		if next == -1 {
+			return text, false
+		}
+		idx += next + 1
+	}
+	if idx == len(text) {
+		return text, false
+	}
+	return text[:idx], true
+}
+
+// truncateDiff keeps the first `--max-diff-lines` lines of a file's diff and
+// reports whether the diff is incomplete.
+func (c *config) truncateDiff(file *git.DiffFile) bool {
+	if c.MaxDiffLines <= 0 {
+		return file.IsIncomplete()
+	}
+
+	num := 0
+	for i, section := range file.Sections {
+		// the first line is the `@@` header
+		lines := len(section.Lines) - 1
+		if num+lines <= c.MaxDiffLines {
+			num += lines
+			continue
+		}
+
+		keep := c.MaxDiffLines - num
+		if keep == 0 {
+			file.Sections = file.Sections[:i]
+		} else {
+			section.Lines = section.Lines[:keep+1]
+			file.Sections = file.Sections[:i+1]
+		}
+		return true
+	}
+	return file.IsIncomplete()
+}
+
+// truncateCombined reads a combined diff up to the first `--max-diff-files`
+// files and the first `--max-diff-lines` lines of each, it reports whether
+// anything was cut.
+func (c *config) truncateCombined(r io.Reader) (string, bool, error) {
+	var out strings.Builder
+	truncated := false
+	files := 0
+	lines := 0
+	inHunk := false
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "diff --cc ") || strings.HasPrefix(line, "diff --combined "):
+			files += 1
+			if c.MaxDiffFiles > 0 && files > c.MaxDiffFiles {
+				return out.String(), true, nil
+			}
+			lines = 0
+			inHunk = false
+			out.WriteString(line)
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			if c.MaxDiffLines > 0 && lines >= c.MaxDiffLines {
+				truncated = true
+				break
+			}
+			out.WriteString(line)
+		case inHunk:
+			lines += 1
+			if c.MaxDiffLines > 0 && lines > c.MaxDiffLines {
+				truncated = true
+				break
+			}
+			out.WriteString(line)
+		default:
+			out.WriteString(line)
+		}
+
+		if err == io.EOF {
+			return out.String(), truncated, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+}
+
+// readHead reads at most n bytes from the start of a file.
+func readHead(fp string, n int) ([]byte, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := make([]byte, n)
+	read, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return b[:read], nil
+}
+
+// countLines counts lines the same way as splitting the whole file on
+// newlines without reading it into memory.
+func countLines(fp string) (int, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	num := 1
+	buf := make([]byte, 32*1024)
+	for {
+		read, err := f.Read(buf)
+		num += bytes.Count(buf[:read], []byte{'\n'})
+		if err == io.EOF {
+			return num, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
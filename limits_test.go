@@ -0,0 +1,154 @@
+package pgit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	git "github.com/gogs/git-module"
+)
+
+// diffFile has a section for every count, each with its `@@` header and that
+// many lines.
+func diffFile(counts ...int) *git.DiffFile {
+	file := &git.DiffFile{Name: "a.txt"}
+	for _, count := range counts {
+		section := &git.DiffSection{
+			Lines: []*git.DiffLine{{Type: git.DiffLineSection, Content: "@@ -1 +1 @@"}},
+		}
+		for i := 0; i < count; i++ {
+			section.Lines = append(section.Lines, &git.DiffLine{Type: git.DiffLineAdd, Content: "+a"})
+		}
+		file.Sections = append(file.Sections, section)
+	}
+	return file
+}
+
+// sectionLines counts the lines of every section without its header.
+func sectionLines(file *git.DiffFile) []int {
+	counts := []int{}
+	for _, section := range file.Sections {
+		counts = append(counts, len(section.Lines)-1)
+	}
+	return counts
+}
+
+func TestTruncateDiff(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLines  int
+		sections  []int
+		want      []int
+		truncated bool
+	}{
+		{"no limit", 0, []int{5, 5}, []int{5, 5}, false},
+		{"under", 3, []int{2}, []int{2}, false},
+		{"exact", 3, []int{1, 2}, []int{1, 2}, false},
+		{"cut section", 3, []int{5}, []int{3}, true},
+		{"cut second section", 3, []int{2, 2}, []int{2, 1}, true},
+		// a section without any lines left is dropped with its header
+		{"drop section", 3, []int{3, 2}, []int{3}, true},
+	}
+	for _, tt := range tests {
+		c := &config{MaxDiffLines: tt.maxLines}
+		file := diffFile(tt.sections...)
+		truncated := c.truncateDiff(file)
+		if truncated != tt.truncated {
+			t.Errorf("%s: got truncated %v, want %v", tt.name, truncated, tt.truncated)
+		}
+		if got := sectionLines(file); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got sections %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	tests := []struct {
+		maxLines  int
+		text      string
+		want      string
+		truncated bool
+	}{
+		{0, "a\nb\nc\n", "a\nb\nc\n", false},
+		{3, "a\nb\nc\n", "a\nb\nc\n", false},
+		{3, "a\nb\nc", "a\nb\nc", false},
+		{2, "a\nb\nc\n", "a\nb\n", true},
+		{2, "a\nb\nc", "a\nb\n", true},
+	}
+	for _, tt := range tests {
+		c := &config{MaxFileLines: tt.maxLines}
+		got, truncated := c.truncateLines(tt.text)
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("truncateLines(%q) with max %d: got (%q, %v), want (%q, %v)", tt.text, tt.maxLines, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+func TestTruncateCombined(t *testing.T) {
+	fileA := "diff --cc a.txt\nindex 1,2..3\n--- a/a.txt\n+++ b/a.txt\n@@@ -1,1 -1,1 +1,2 @@@\n- a\n -b\n++c\n"
+	fileB := "diff --cc b.txt\nindex 4,5..6\n--- a/b.txt\n+++ b/b.txt\n@@@ -1,1 -1,1 +1,1 @@@\n++d\n"
+	tests := []struct {
+		name      string
+		maxFiles  int
+		maxLines  int
+		want      string
+		truncated bool
+	}{
+		{"no limit", 0, 0, fileA + fileB, false},
+		{"under", 2, 3, fileA + fileB, false},
+		{"cut files", 1, 0, fileA, true},
+		{
+			"cut lines", 0, 2,
+			"diff --cc a.txt\nindex 1,2..3\n--- a/a.txt\n+++ b/a.txt\n@@@ -1,1 -1,1 +1,2 @@@\n- a\n -b\n" + fileB,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		c := &config{MaxDiffFiles: tt.maxFiles, MaxDiffLines: tt.maxLines}
+		got, truncated, err := c.truncateCombined(strings.NewReader(fileA + fileB))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("%s: got (%q, %v), want (%q, %v)", tt.name, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+// Only the first `--max-diff-files` files of a commit are shown, the commit
+// page links the full patch instead.
+func TestMaxDiffFiles(t *testing.T) {
+	dir := testRepo(t)
+	commitID := testCommit(t, dir, 1, "first", map[string]string{
+		"a.txt": "a\n",
+		"b.txt": "b\n",
+		"c.txt": "c\n",
+	})
+	outdir := t.TempDir()
+
+	report := testBuildOpts(t, Options{
+		RepoPath:     dir,
+		Outdir:       outdir,
+		MaxDiffFiles: 2,
+	})
+	if report.HasErrors() {
+		t.Fatal(report.Errors)
+	}
+
+	b, err := os.ReadFile(filepath.Join(outdir, "commits", commitID+".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(b)
+	if !strings.Contains(page, "only the first 2 are shown") {
+		t.Error("commit page does not say files were left out")
+	}
+	if strings.Contains(page, "diff-c.txt") {
+		t.Error("commit page shows the file past the limit")
+	}
+	if !fileExists(filepath.Join(outdir, "commits", commitID+".patch")) {
+		t.Error("full patch was not written")
+	}
+}
@@ -0,0 +1,353 @@
+package pgit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+)
+
+const manifestFilename = "pgit-manifest.json"
+
+// manifest records what was rendered into the output directory so subsequent
+// builds can skip pages whose inputs have not changed.
+type manifest struct {
+	// pgit version that produced the output
+	Version string `json:"version"`
+	// hash of the templates, static assets, theme and site-wide settings
+	Hash string `json:"hash"`
+	// commit ids whose commit page has been rendered
+	Commits map[string]bool `json:"commits"`
+	// rev name -> rev id
+	Revs map[string]string `json:"revs"`
+	// rev name -> file path -> blob
+	Blobs map[string]map[string]*blobInfo `json:"blobs"`
+	// archive file name -> commit id
+	Archives map[string]string `json:"archives"`
+}
+
+// blobInfo is what we need to know about a file page we skip rendering.
+type blobInfo struct {
+	ID string `json:"id"`
+	// the file page shows these too, a revert brings back an earlier blob
+	// but with a different last commit
+	Mode       string `json:"mode"`
+	CommitID   string `json:"commitID"`
+	IsTextFile bool   `json:"isText"`
+	NumLines   int    `json:"numLines"`
+	// dimensions of an image for the tree page
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// a blame page was written for the file
+	Blame bool `json:"blame,omitempty"`
+}
+
+func newManifest(version, hash string) *manifest {
+	return &manifest{
+		Version:  version,
+		Hash:     hash,
+		Commits:  map[string]bool{},
+		Revs:     map[string]string{},
+		Blobs:    map[string]map[string]*blobInfo{},
+		Archives: map[string]string{},
+	}
+}
+
+// buildManifest holds the manifest from the previous build, which we read
+// from, and the manifest for the current build, which we write to.
+type buildManifest struct {
+	mu   sync.Mutex
+	prev *manifest
+	next *manifest
+}
+
+const modulePath = "github.com/picosh/pgit"
+
+// pgitVersion identifies the build of pgit so upgrading it invalidates
+// previous output. Builds without a version, e.g. `go build` in a modified
+// checkout or with a `replace` directive, use a hash of the executable and
+// it is empty when we cannot tell at all.
+func pgitVersion() string {
+	info, _ := debug.ReadBuildInfo()
+	version := buildVersion(info)
+	if version != "" {
+		return version
+	}
+	return executableHash()
+}
+
+// noVersion is what go reports for a module built from a directory.
+const noVersion = "(devel)"
+
+// buildVersion returns the module version and vcs revision this binary was
+// built from, empty when they do not pin the source.
+func buildVersion(info *debug.BuildInfo) string {
+	if info == nil {
+		return ""
+	}
+	// built into another program as a library
+	if info.Main.Path != modulePath {
+		for _, dep := range info.Deps {
+			if dep.Path != modulePath {
+				continue
+			}
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			if dep.Version == noVersion {
+				return ""
+			}
+			return dep.Version
+		}
+		return ""
+	}
+
+	version := info.Main.Version
+	revision := ""
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			if setting.Value == "true" {
+				return ""
+			}
+		}
+	}
+	if revision != "" {
+		return version + "+" + revision
+	}
+	if version == noVersion {
+		return ""
+	}
+	return version
+}
+
+// executableHash hashes the running binary, empty when it cannot be read.
+func executableHash() string {
+	fp, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return ""
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// hashes everything that affects every page we generate.
+func (c *config) outputHash() (string, error) {
+	h := sha256.New()
+	for _, fsys := range []fs.FS{c.templateFS(), c.assetFS()} {
+		err := fs.WalkDir(fsys, ".", func(fp string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			b, err := fs.ReadFile(fsys, fp)
+			if err != nil {
+				return err
+			}
+			h.Write([]byte(fp))
+			h.Write(b)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	settings, err := json.Marshal([]any{
+		c.Theme.Name,
+		c.RepoName,
+		c.Desc,
+		c.Readme,
+		c.HideTreeLastCommit,
+		c.NoHistory,
+		c.Blame,
+		c.DiffView,
+		c.CombinedDiff,
+		c.CommitFiles,
+		c.Archives,
+		c.ArchiveTags,
+		c.MaxFileSize,
+		c.MaxFileLines,
+		c.MaxDiffLines,
+		c.MaxDiffFiles,
+		c.HomeURL,
+		c.CloneURL,
+		c.RootRelative,
+		c.BaseURL,
+		c.AssetRoot,
+	})
+	if err != nil {
+		return "", err
+	}
+	h.Write(settings)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *config) manifestPath() string {
+	return filepath.Join(c.Outdir, manifestFilename)
+}
+
+// loadManifest reads the manifest of the previous build. The previous
+// manifest is discarded when `--force` is set or when it was produced by a
+// different pgit version, templates or settings.
+func (c *config) loadManifest() (*buildManifest, error) {
+	hash, err := c.outputHash()
+	if err != nil {
+		return nil, err
+	}
+	version := pgitVersion()
+
+	bm := &buildManifest{
+		prev: newManifest(version, hash),
+		next: newManifest(version, hash),
+	}
+
+	if c.Force {
+		c.Logger.Info("force flag provided, ignoring build manifest")
+		return bm, nil
+	}
+	if version == "" {
+		c.Logger.Info("could not tell which build of pgit wrote the manifest, ignoring build manifest")
+		return bm, nil
+	}
+
+	b, err := os.ReadFile(c.manifestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return bm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prev := newManifest("", "")
+	err = json.Unmarshal(b, prev)
+	if err != nil {
+		c.Logger.Error("could not parse build manifest, rebuilding", "err", err)
+		return bm, nil
+	}
+
+	if prev.Version != version || prev.Hash != hash {
+		c.Logger.Info(
+			"build manifest is stale, rebuilding",
+			"version", prev.Version,
+			"hash", prev.Hash,
+		)
+		return bm, nil
+	}
+
+	bm.prev = prev
+	// commit pages never change so we keep track of them across builds
+	for id := range prev.Commits {
+		bm.next.Commits[id] = true
+	}
+
+	return bm, nil
+}
+
+func (c *config) saveManifest() error {
+	c.Manifest.mu.Lock()
+	defer c.Manifest.mu.Unlock()
+
+	b, err := json.Marshal(c.Manifest.next)
+	if err != nil {
+		return err
+	}
+	c.Logger.Info("writing", "filepath", c.manifestPath())
+	return os.WriteFile(c.manifestPath(), b, 0644)
+}
+
+func (m *buildManifest) hasCommit(commitID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prev.Commits[commitID]
+}
+
+func (m *buildManifest) addCommit(commitID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next.Commits[commitID] = true
+}
+
+func (m *buildManifest) hasRev(name, revID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prev.Revs[name] == revID
+}
+
+// addRev records a rev as rendered. When `unchanged` is set we carry over the
+// blobs we rendered for it last time since we did not walk the tree again.
+func (m *buildManifest) addRev(name, revID string, unchanged bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next.Revs[name] = revID
+	if unchanged {
+		m.next.Blobs[name] = m.prev.Blobs[name]
+	}
+}
+
+// getBlob returns the blob we rendered at the path for the rev in the
+// previous build, if it has the same id, mode and last commit.
+func (m *buildManifest) getBlob(rev, fpath string, want *blobInfo) *blobInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	blob := m.prev.Blobs[rev][fpath]
+	if blob == nil ||
+		blob.ID != want.ID ||
+		blob.Mode != want.Mode ||
+		blob.CommitID != want.CommitID {
+		return nil
+	}
+	return blob
+}
+
+// getRevBlobs returns every blob we rendered for the rev in the previous
+// build.
+func (m *buildManifest) getRevBlobs(rev string) map[string]*blobInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prev.Blobs[rev]
+}
+
+func (m *buildManifest) addBlob(rev, fpath string, blob *blobInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.next.Blobs[rev] == nil {
+		m.next.Blobs[rev] = map[string]*blobInfo{}
+	}
+	m.next.Blobs[rev][fpath] = blob
+}
+
+func (m *buildManifest) hasArchive(fname, commitID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.prev.Archives[fname] == commitID
+}
+
+func (m *buildManifest) addArchive(fname, commitID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next.Archives[fname] = commitID
+}
+
+func fileExists(fp string) bool {
+	_, err := os.Stat(fp)
+	return err == nil
+}
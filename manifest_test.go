@@ -0,0 +1,75 @@
+package pgit
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestBuildVersion(t *testing.T) {
+	vcs := func(revision, modified string) []debug.BuildSetting {
+		return []debug.BuildSetting{
+			{Key: "vcs.revision", Value: revision},
+			{Key: "vcs.modified", Value: modified},
+		}
+	}
+	dep := func(version string, replace *debug.Module) *debug.BuildInfo {
+		return &debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/site", Version: noVersion},
+			Deps: []*debug.Module{
+				{Path: "example.com/other", Version: "v2.0.0"},
+				{Path: modulePath, Version: version, Replace: replace},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		info *debug.BuildInfo
+		want string
+	}{
+		{"no build info", nil, ""},
+		{
+			"go install",
+			&debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: "v1.2.0"}},
+			"v1.2.0",
+		},
+		{
+			"go build in a checkout",
+			&debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: noVersion}, Settings: vcs("abc123", "false")},
+			"(devel)+abc123",
+		},
+		{
+			"modified checkout",
+			&debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: noVersion}, Settings: vcs("abc123", "true")},
+			"",
+		},
+		{
+			"no vcs stamping",
+			&debug.BuildInfo{Main: debug.Module{Path: modulePath, Version: noVersion}},
+			"",
+		},
+		{"library", dep("v1.2.0", nil), "v1.2.0"},
+		{"library replaced by a version", dep("v1.2.0", &debug.Module{Path: "example.com/fork", Version: "v1.2.1"}), "v1.2.1"},
+		{"library replaced by a directory", dep("v1.2.0", &debug.Module{Path: "../pgit"}), ""},
+		{"library in a workspace", dep(noVersion, nil), ""},
+		{"library missing", &debug.BuildInfo{Main: debug.Module{Path: "example.com/site"}}, ""},
+	}
+	for _, tt := range tests {
+		got := buildVersion(tt.info)
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPgitVersion(t *testing.T) {
+	// test binaries have no version so they fall back to their hash
+	version := pgitVersion()
+	if !strings.HasPrefix(version, "sha256:") {
+		t.Errorf("got %q, want a hash of the test binary", version)
+	}
+	if pgitVersion() != version {
+		t.Error("version changed between calls")
+	}
+}
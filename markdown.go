@@ -0,0 +1,78 @@
+package pgit
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	formatterHtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	mdHtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// file extensions we render as html instead of highlighted source.
+var markdownExts = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".mdown":    true,
+	".mkd":      true,
+}
+
+func isMarkdownFile(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return markdownExts[ext]
+}
+
+// newMarkdown creates a CommonMark parser with GFM extensions where fenced
+// code blocks are highlighted using the same chroma classes as the rest of
+// the site so `syntax.css` applies to them.
+func newMarkdown(theme *chroma.Style) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithCustomStyle(theme),
+				highlighting.WithFormatOptions(
+					formatterHtml.WithClasses(true),
+				),
+			),
+		),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(
+			// raw html is allowed because we sanitize the output afterwards
+			mdHtml.WithUnsafe(),
+		),
+	)
+}
+
+// newSanitizer creates a policy for user generated content that also keeps
+// the attributes produced by syntax highlighting and GFM task lists.
+func newSanitizer() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").
+		Matching(regexp.MustCompile(`^[\w\s-]+$`)).
+		OnElements("span", "pre", "code", "div")
+	policy.AllowAttrs("type").
+		Matching(regexp.MustCompile(`^checkbox$`)).
+		OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	return policy
+}
+
+// renders markdown into sanitized html.
+func (c *config) parseMarkdown(text string) (string, error) {
+	var buf bytes.Buffer
+	err := c.Markdown.Convert([]byte(text), &buf)
+	if err != nil {
+		return "", err
+	}
+	return c.Sanitizer.Sanitize(buf.String()), nil
+}
@@ -0,0 +1,196 @@
+package pgit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	git "github.com/gogs/git-module"
+	_ "golang.org/x/image/webp"
+)
+
+// mediaTypes maps file extensions to how the file page embeds them, every
+// other binary file gets a download link.
+var mediaTypes = map[string]string{
+	".png":  "image",
+	".jpg":  "image",
+	".jpeg": "image",
+	".gif":  "image",
+	".webp": "image",
+	".svg":  "image",
+	".mp3":  "audio",
+	".m4a":  "audio",
+	".ogg":  "audio",
+	".oga":  "audio",
+	".wav":  "audio",
+	".flac": "audio",
+	".mp4":  "video",
+	".m4v":  "video",
+	".webm": "video",
+	".ogv":  "video",
+	".mov":  "video",
+	".pdf":  "pdf",
+}
+
+func getMediaType(fname string) string {
+	return mediaTypes[strings.ToLower(filepath.Ext(fname))]
+}
+
+// svgs larger than this are not embedded in their file page.
+const maxInlineSVGSize = 256 * 1024
+
+func isSVG(fname string) bool {
+	return strings.ToLower(filepath.Ext(fname)) == ".svg"
+}
+
+// svgDataURL embeds an svg in a data url. The raw file is served as text
+// because an svg opened on its own runs its scripts, an image does not. It is
+// empty when the svg is too large to embed.
+func svgDataURL(entry *git.TreeEntry) (template.URL, error) {
+	if entry.Size() > maxInlineSVGSize {
+		return "", nil
+	}
+	b, err := entry.Blob().Bytes()
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString(b)), nil
+}
+
+// imageSize returns the dimensions of an image without decoding all of it,
+// zero when we cannot tell.
+func imageSize(fname string, r io.Reader) (int, int) {
+	if isSVG(fname) {
+		return svgSize(r)
+	}
+
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// svgSize reads the size from the `width` and `height` of the root element
+// and falls back to its `viewBox`.
+func svgSize(r io.Reader) (int, int) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if el.Name.Local != "svg" {
+			return 0, 0
+		}
+
+		var width, height int
+		var viewBox string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = svgLength(attr.Value)
+			case "height":
+				height = svgLength(attr.Value)
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
+		if width > 0 && height > 0 {
+			return width, height
+		}
+
+		fields := strings.Fields(strings.ReplaceAll(viewBox, ",", " "))
+		if len(fields) != 4 {
+			return 0, 0
+		}
+		return svgLength(fields[2]), svgLength(fields[3])
+	}
+}
+
+// svgLength parses a length in pixels, relative units like `%` or `em` have
+// no size on their own.
+func svgLength(value string) int {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil || num < 0 {
+		return 0
+	}
+	return int(num + 0.5)
+}
+
+// readMedia reads what the file page needs to embed an item, svgs are
+// inlined and images get their dimensions. The tree walker leaves this to the
+// file page so we only read the blob when the page is written.
+func (c *config) readMedia(item *treeItem) error {
+	if item.Media == "" {
+		return nil
+	}
+
+	if isSVG(item.Name) {
+		// the svg source is still shown without the image
+		url, err := svgDataURL(item.Entry)
+		item.MediaURL = url
+		if url == "" {
+			item.Media = ""
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if item.Media != "image" {
+		return nil
+	}
+	return c.readImageSize(item)
+}
+
+// imageHeaderSize is how much of an image we read to find its dimensions,
+// every format we support keeps them at the start.
+const imageHeaderSize = 64 * 1024
+
+// readImageSize sets the dimensions of an image tree item from the start of
+// its blob. Images over `--max-file-size` are left without them.
+func (c *config) readImageSize(item *treeItem) error {
+	if c.isTooLarge(item.Entry.Size()) {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stderr := new(bytes.Buffer)
+		err := item.Entry.Blob().Pipeline(pw, stderr)
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, stderr.String())
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	header, err := io.ReadAll(io.LimitReader(pr, imageHeaderSize))
+	// git stops once it cannot write the rest of the blob, the error it
+	// exits with is ours
+	_ = pr.Close()
+	<-done
+	if err != nil {
+		return err
+	}
+
+	item.Width, item.Height = imageSize(item.Name, bytes.NewReader(header))
+	return nil
+}
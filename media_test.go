@@ -0,0 +1,136 @@
+package pgit
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+
+	git "github.com/gogs/git-module"
+)
+
+func encodePNG(t *testing.T, img image.Image) string {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	err := png.Encode(buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// noisePNG barely compresses so it is larger than the header we read.
+func noisePNG(t *testing.T, width, height int) string {
+	t.Helper()
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rnd.Intn(256))
+	}
+	return encodePNG(t, img)
+}
+
+func TestSvgSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		svg    string
+		width  int
+		height int
+	}{
+		{"size", `<svg width="10" height="20"></svg>`, 10, 20},
+		{"px", `<?xml version="1.0"?><!-- logo --><svg width="10px" height="20.4px"/>`, 10, 20},
+		{"viewBox", `<svg width="100%" viewBox="0 0 30 40"/>`, 30, 40},
+		{"viewBox commas", `<svg viewBox="0,0,30.5,40"/>`, 31, 40},
+		{"no size", `<svg width="10"/>`, 0, 0},
+		{"bad viewBox", `<svg viewBox="0 0 30"/>`, 0, 0},
+		{"not svg", `<html width="10" height="20"/>`, 0, 0},
+		{"not xml", `PNG`, 0, 0},
+	}
+	for _, tt := range tests {
+		width, height := svgSize(strings.NewReader(tt.svg))
+		if width != tt.width || height != tt.height {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.name, width, height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestImageSize(t *testing.T) {
+	gifBuf := new(bytes.Buffer)
+	pal := image.NewPaletted(image.Rect(0, 0, 7, 5), color.Palette{color.Black})
+	err := gif.Encode(gifBuf, pal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fname  string
+		data   string
+		width  int
+		height int
+	}{
+		{"a.png", encodePNG(t, image.NewRGBA(image.Rect(0, 0, 3, 2))), 3, 2},
+		{"a.GIF", gifBuf.String(), 7, 5},
+		{"a.SVG", `<svg width="4" height="6"/>`, 4, 6},
+		// the extension only matters for svgs
+		{"a.jpg", encodePNG(t, image.NewRGBA(image.Rect(0, 0, 3, 2))), 3, 2},
+		{"a.png", "not an image", 0, 0},
+	}
+	for _, tt := range tests {
+		width, height := imageSize(tt.fname, strings.NewReader(tt.data))
+		if width != tt.width || height != tt.height {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.fname, width, height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestReadImageSize(t *testing.T) {
+	large := noisePNG(t, 200, 200)
+	if len(large) <= imageHeaderSize {
+		t.Fatalf("noise png is only %d bytes", len(large))
+	}
+
+	dir := testRepo(t)
+	commitID := testCommit(t, dir, 1, "images", map[string]string{
+		"small.png": encodePNG(t, image.NewRGBA(image.Rect(0, 0, 3, 2))),
+		"large.png": large,
+	})
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CatFileCommit(commitID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fname       string
+		maxFileSize int64
+		width       int
+		height      int
+	}{
+		{"small.png", 0, 3, 2},
+		{"large.png", 0, 200, 200},
+		{"large.png", 1024, 0, 0},
+	}
+	for _, tt := range tests {
+		entry, err := commit.TreeEntry(tt.fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := testConfig(t)
+		c.MaxFileSize = tt.maxFileSize
+		item := &treeItem{Name: tt.fname, Entry: entry}
+		err = c.readImageSize(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Width != tt.width || item.Height != tt.height {
+			t.Errorf("%s with max %d: got %dx%d, want %dx%d", tt.fname, tt.maxFileSize, item.Width, item.Height, tt.width, tt.height)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pgit
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	git "github.com/gogs/git-module"
+)
+
+// symlinkData is where a symlink in the tree points to.
+type symlinkData struct {
+	Target string
+	// set when the target resolves to a file or directory inside the tree
+	URL template.URL
+}
+
+// modeString formats a tree entry mode the way `ls -l` would, git only keeps
+// the executable bit so the rest is implied.
+func modeString(mode git.EntryMode) string {
+	switch mode {
+	case git.EntryTree:
+		return "d---------"
+	case git.EntryExec:
+		return "-rwxr-xr-x"
+	case git.EntrySymlink:
+		return "lrwxrwxrwx"
+	case git.EntryCommit:
+		return "m---------"
+	default:
+		return "-rw-r--r--"
+	}
+}
+
+// isModeChange reports whether a diff changes the mode of a file, the content
+// may have changed too.
+func isModeChange(file *git.DiffFile) bool {
+	return file.Type == git.DiffFileChange &&
+		file.OldMode() != 0 &&
+		file.Mode() != 0 &&
+		file.OldMode() != file.Mode()
+}
+
+// newSymlink reads the target of a symlink and links to it when it stays
+// inside the tree.
+func (tw *treeWalker) newSymlink(item *treeItem) (*symlinkData, error) {
+	b, err := item.Entry.Blob().Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	link := &symlinkData{Target: string(b)}
+	if filepath.IsAbs(link.Target) {
+		return link, nil
+	}
+
+	target := filepath.Join(filepath.Dir(item.Path), link.Target)
+	if target == ".." || strings.HasPrefix(target, "../") {
+		return link, nil
+	}
+	if target == "." {
+		link.URL = tw.Config.getTreeURL(tw.PageData.RevData)
+		return link, nil
+	}
+
+	entry, err := tw.Root.TreeEntry(target)
+	// a dangling symlink is not an error
+	if err != nil {
+		return link, nil
+	}
+
+	switch entry.Type() {
+	case git.ObjectTree:
+		link.URL = tw.Config.compileURL(
+			filepath.Join(getFileBaseDir(tw.PageData.RevData), target),
+			"index.html",
+		)
+	case git.ObjectBlob:
+		link.URL = tw.Config.getFileURL(tw.PageData.RevData, fmt.Sprintf("%s.html", target))
+	}
+	return link, nil
+}
@@ -0,0 +1,257 @@
+package pgit
+
+import (
+	"bufio"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	git "github.com/gogs/git-module"
+)
+
+type repoSummary struct {
+	Name          string
+	Desc          string
+	URL           template.URL
+	DefaultBranch string
+	LastCommit    string
+}
+
+type indexPageData struct {
+	*pageData
+	Repos []*repoSummary
+}
+
+func isGitRepo(dir string) bool {
+	// non-bare repos
+	if fileExists(filepath.Join(dir, ".git")) {
+		return true
+	}
+	// bare repos
+	return fileExists(filepath.Join(dir, "HEAD")) && fileExists(filepath.Join(dir, "objects"))
+}
+
+// FindRepos returns every git repo that is a direct child of dir.
+func FindRepos(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := []string{}
+	for _, e := range entries {
+		fp := filepath.Join(dir, e.Name())
+		if e.IsDir() && isGitRepo(fp) {
+			repos = append(repos, fp)
+		}
+	}
+	return repos, nil
+}
+
+// ReadReposFile reads a list of repo paths, one per line. Blank lines and
+// lines starting with `#` are ignored and relative paths are resolved
+// against the directory of the file.
+func ReadReposFile(fp string) ([]string, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	repos := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(fp), line)
+		}
+		repos = append(repos, line)
+	}
+	return repos, scanner.Err()
+}
+
+// readRepoFile reads metadata files that gitweb and stagit use to describe a
+// repo (e.g. `description`, `cloneurl`).
+func readRepoFile(repoPath, name string) string {
+	for _, fp := range []string{
+		filepath.Join(repoPath, ".git", name),
+		filepath.Join(repoPath, name),
+	} {
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			continue
+		}
+		str := strings.TrimSpace(string(b))
+		// default description created by `git init`
+		if strings.HasPrefix(str, "Unnamed repository;") {
+			return ""
+		}
+		return str
+	}
+	return ""
+}
+
+func multiRepoName(repoPath string) string {
+	return strings.TrimSuffix(repoName(repoPath), ".git")
+}
+
+func defaultBranch(repo *git.Repository) string {
+	ref, err := repo.SymbolicRef()
+	if err != nil {
+		return ""
+	}
+	return git.RefShortName(ref)
+}
+
+// forRepo creates the config for a single repo inside of a multi-repo site.
+// Every repo lives in its own subdirectory while static assets are shared.
+func (c *config) forRepo(entry *RepoEntry) *config {
+	name := entry.Label
+	if name == "" {
+		name = multiRepoName(entry.Path)
+	}
+
+	homeURL := c.HomeURL
+	if homeURL == "" {
+		homeURL = template.URL(c.RootRelative + "index.html")
+	}
+
+	cloneURL := entry.CloneURL
+	if cloneURL == "" {
+		cloneURL = readRepoFile(entry.Path, "cloneurl")
+	}
+
+	// `--desc` describes the index page so it should not override every repo
+	setFlags := map[string]bool{}
+	for key, value := range c.SetFlags {
+		if key != "desc" {
+			setFlags[key] = value
+		}
+	}
+
+	// every setting carries over, the report and worker pool are shared by
+	// the whole site while the state of a build belongs to a single repo
+	config := *c
+	config.Outdir = filepath.Join(c.Outdir, name)
+	config.RepoPath = entry.Path
+	config.RepoName = name
+	config.Desc = readRepoFile(entry.Path, "description")
+	config.HomeURL = homeURL
+	config.CloneURL = template.URL(cloneURL)
+	config.RootRelative = c.RootRelative + name + "/"
+	config.SetFlags = setFlags
+	config.Logger = c.Logger.With("repo", name)
+	config.Cache = newPageCache()
+	config.Manifest = nil
+	config.LastCommits = nil
+	return &config
+}
+
+// repoRevs resolves the revisions we build for a repo in a multi-repo site.
+// `HEAD` is replaced with the default branch so urls use the branch name and
+// revisions that do not exist in this repo are skipped.
+func (c *config) repoRevs(repo *git.Repository, branch string) []string {
+	revs := []string{}
+	for _, rev := range c.Revs {
+		if rev == "HEAD" && branch != "" {
+			rev = branch
+		}
+		if _, err := repo.RevParse(rev); err != nil {
+			c.Logger.Info("revision not found, skipping", "repoPath", repo.Path(), "revision", rev)
+			continue
+		}
+		revs = append(revs, rev)
+	}
+	return revs
+}
+
+// writeRepos builds every repo into its own subdirectory of the output
+// directory and generates a root index page that links to all of them.
+// Repos that fail to build are reported and left out of the index.
+//
+// Settings are layered from lowest to highest precedence: the site config,
+// the `.pgit.toml` committed in the repo, the `[[repos]]` entry for the repo
+// and finally `Options.Override`, the flags passed on the command line.
+func (c *config) writeRepos(entries []*RepoEntry) error {
+	summaries := []*repoSummary{}
+	for _, entry := range entries {
+		repo, err := git.Open(entry.Path)
+		if err != nil {
+			err = c.reportErr(err, "", entry.Path)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		config := c.forRepo(entry)
+		err = config.reportErr(config.loadRepoConfig(repo), "", repoConfigFilename)
+		if err != nil {
+			return err
+		}
+		config.applyRepoConfig(&entry.RepoConfig)
+
+		branch := defaultBranch(repo)
+		config.Revs = config.repoRevs(repo, branch)
+		if len(config.Revs) == 0 {
+			c.Logger.Info("no revisions found for repo, skipping", "repoPath", entry.Path)
+			continue
+		}
+
+		// repos with their own theme need their own stylesheets
+		if config.Theme != c.Theme {
+			config.AssetRoot = config.RootRelative
+			err = config.reportErr(config.writeAssets(), "", "syntax.css")
+			if err != nil {
+				return err
+			}
+		}
+
+		output, err := config.writeRepo()
+		if err != nil {
+			err = config.reportErr(err, "", "")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		summary := &repoSummary{
+			Name:          config.RepoName,
+			Desc:          config.Desc,
+			URL:           config.getSummaryURL(),
+			DefaultBranch: branch,
+		}
+		if output.LastCommit != nil {
+			summary.LastCommit = output.LastCommit.Committer.When.Format(time.DateOnly)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	return c.writeIndex(summaries)
+}
+
+func (c *config) writeIndex(repos []*repoSummary) error {
+	c.Logger.Info("writing index", "outdir", c.Outdir)
+	return c.writeHtml(&writeData{
+		Filename: "index.html",
+		Template: "index.page.tmpl",
+		Data: &indexPageData{
+			pageData: &pageData{
+				Repo:     c,
+				SiteURLs: &siteURLs{},
+			},
+			Repos: repos,
+		},
+	})
+}
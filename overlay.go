@@ -0,0 +1,152 @@
+package pgit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// overlayFS serves files from upper and falls back to lower for anything
+// upper does not have. Directories list the entries of both.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.lower.Open(name)
+}
+
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	merged := map[string]fs.DirEntry{}
+	found := false
+	for _, fsys := range []fs.FS{o.lower, o.upper} {
+		entries, err := fs.ReadDir(fsys, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, e := range entries {
+			merged[e.Name()] = e
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// overlay merges a directory over an embedded one, the embedded files are
+// used as is when dir is empty.
+func overlay(embedded fs.FS, subdir, dir string) fs.FS {
+	lower, err := fs.Sub(embedded, subdir)
+	if err != nil {
+		// subdir is a constant that always exists in the binary
+		panic(err)
+	}
+	if dir == "" {
+		return lower
+	}
+	return &overlayFS{upper: os.DirFS(dir), lower: lower}
+}
+
+// templateFS holds every template by name, the ones in `--templates` replace
+// the embedded ones.
+func (c *config) templateFS() fs.FS {
+	return overlay(embedFS, "html", c.TemplatesDir)
+}
+
+// assetFS holds every static asset, the ones in `--static` replace the
+// embedded ones.
+func (c *config) assetFS() fs.FS {
+	return overlay(staticFS, "static", c.StaticDir)
+}
+
+// absDir resolves a directory passed as a flag and makes sure it exists before
+// we build.
+func absDir(flagName, dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("--%s: %w", flagName, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("--%s: %s is not a directory", flagName, dir)
+	}
+	return dir, nil
+}
+
+// customPages finds the page templates in `--templates` that pgit does not
+// have a page for, e.g. `about.page.tmpl`.
+func (c *config) customPages() ([]string, error) {
+	if c.TemplatesDir == "" {
+		return nil, nil
+	}
+
+	names, err := fs.Glob(os.DirFS(c.TemplatesDir), "*.page.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []string{}
+	for _, name := range names {
+		_, err := fs.Stat(embedFS, path.Join("html", name))
+		if errors.Is(err, fs.ErrNotExist) {
+			pages = append(pages, name)
+		}
+	}
+	return pages, nil
+}
+
+// writeCustomPages renders every custom page template to the root of the repo,
+// `about.page.tmpl` becomes `about.html`. A page that fails is reported and
+// skipped.
+func (c *config) writeCustomPages(data *pageData) error {
+	pages, err := c.customPages()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range pages {
+		fname := strings.TrimSuffix(name, ".page.tmpl") + ".html"
+		err := c.writeHtml(&writeData{
+			Filename: fname,
+			Template: name,
+			Data:     data,
+		})
+		err = c.reportErr(err, "", fname)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
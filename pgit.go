@@ -0,0 +1,2045 @@
+package pgit
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	formatterHtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/dustin/go-humanize"
+	git "github.com/gogs/git-module"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"golang.org/x/sync/errgroup"
+)
+
+//go:embed html/*.tmpl
+var embedFS embed.FS
+
+//go:embed static/*
+var staticFS embed.FS
+
+type config struct {
+	// required params
+	Outdir string
+	// abs path to git repo
+	RepoPath string
+
+	// optional params
+	// generate logs anad tree based on the git revisions provided
+	Revs []string
+	// description of repo used in the header of site
+	Desc string
+	// maximum number of commits that we will process in descending order,
+	// a negative number processes every commit
+	MaxCommits int
+	// number of commits on each page of the log
+	LogPageSize int
+	// files over this many bytes are not highlighted, 0 means no limit
+	MaxFileSize int64
+	// only the first lines of longer files are highlighted, 0 means no limit
+	MaxFileLines int
+	// only the first lines of a larger diff of a file are shown, 0 means no
+	// limit
+	MaxDiffLines int
+	// only the first files of a larger diff of a commit are shown, 0 means no
+	// limit
+	MaxDiffFiles int
+	// name of the readme file
+	Readme string
+	// templates in this directory replace the embedded ones with the same
+	// name, new partials and pages are allowed
+	TemplatesDir string
+	// assets in this directory are copied over the embedded ones
+	StaticDir string
+	// every page template parsed with the partials and layout, by name
+	Templates map[string]*template.Template
+	// The latest commit per file is found with a single walk of the history
+	// of each rev, which still reads the entire history of a large repo.
+	// We offer a way to disable showing the latest commit in the output
+	// for those who want a faster build time
+	HideTreeLastCommit bool
+	// keep the latest commit per file between builds so a build only reads
+	// the history since the previous one
+	LastCommitCache bool
+	// history pages need the entire history of every rev, skipping them
+	// lets the last commit lookup stop early and use the cache
+	NoHistory bool
+	// `git blame` is expensive so generating blame pages is opt-in
+	Blame bool
+	// default view for diffs on commit pages, `unified` or `split`
+	DiffView string
+	// also show the combined diff (`git show --cc`) on merge commit pages
+	CombinedDiff bool
+	// write every changed file before and after a commit so line numbers in
+	// its diff link to them, this doubles the pages of every commit
+	CommitFiles bool
+	// write tar.gz and zip archives of every rev
+	Archives bool
+	// also write archives of every tag
+	ArchiveTags bool
+	// shared by every rev and repo to limit how many pages we render at once
+	Pool *workerPool
+	// latest commit per file of every rev, computed
+	LastCommits *lastCommitCache
+	// add a trigram index of text files to the search index so the search
+	// page can find code, this grows with the size of the repo
+	SearchCode bool
+	// ignore the build manifest from a previous run and render every page
+	Force bool
+	// stop at the first page that fails instead of skipping it
+	FailFast bool
+
+	// user-defined urls
+	HomeURL  template.URL
+	CloneURL template.URL
+
+	// https://developer.mozilla.org/en-US/docs/Web/API/URL_API/Resolving_relative_references#root_relative
+	RootRelative string
+	// absolute url of the site root (e.g. https://git.erock.io) which
+	// `RootRelative` is resolved against, required for atom feeds
+	BaseURL string
+	// root relative path to the shared static assets (e.g. `main.css`),
+	// this differs from `RootRelative` when building multiple repos
+	AssetRoot string
+
+	// computed
+	// cache for skipping commits, trees, etc.
+	Cache *pageCache
+	// what we rendered in previous builds and what we render in this one
+	Manifest *buildManifest
+	// pages we skipped because they failed, shared by every repo
+	Report *BuildReport
+	// flags passed on the command line, these win over any config file
+	SetFlags map[string]bool
+	// pretty name for the repo
+	RepoName string
+	// logger
+	Logger *slog.Logger
+	// chroma style
+	Theme     *chroma.Style
+	Formatter *formatterHtml.Formatter
+	// markdown renderer and html sanitizer for readme and markdown files
+	Markdown  goldmark.Markdown
+	Sanitizer *bluemonday.Policy
+}
+
+// pageCache remembers the pages written in this build so a commit shared by
+// several revs is only written once.
+type pageCache struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newPageCache() *pageCache {
+	return &pageCache{seen: map[string]bool{}}
+}
+
+// claim marks key as written and reports whether it was the first to do so.
+func (p *pageCache) claim(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.seen[key] {
+		return false
+	}
+	p.seen[key] = true
+	return true
+}
+
+// has reports whether key was claimed.
+func (p *pageCache) has(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seen[key]
+}
+
+type revInfo interface {
+	ID() string
+	Name() string
+}
+
+type revData struct {
+	id     string
+	name   string
+	Config *config
+}
+
+func (r *revData) ID() string {
+	return r.id
+}
+
+func (r *revData) Name() string {
+	return r.name
+}
+
+func (r *revData) TreeURL() template.URL {
+	return r.Config.getTreeURL(r)
+}
+
+func (r *revData) LogURL() template.URL {
+	return r.Config.getLogsURL(r)
+}
+
+func (r *revData) FeedURL() template.URL {
+	return r.Config.compileURL(getLogBaseDir(r), "atom.xml")
+}
+
+func (r *revData) SearchURL() template.URL {
+	return r.Config.getSearchURL(r)
+}
+
+func (r *revData) Archive() *archiveData {
+	return r.Config.getArchive(r.Name())
+}
+
+type commitData struct {
+	SummaryStr string
+	URL        template.URL
+	WhenStr    string
+	AuthorStr  string
+	ShortID    string
+	// first parent, empty for a root commit
+	ParentID string
+	Refs     []*refInfo
+	*git.Commit
+}
+
+type treeItem struct {
+	IsTextFile bool
+	IsDir      bool
+	Size       string
+	NumLines   int
+	Name       string
+	Icon       string
+	Path       string
+	URL        template.URL
+	CommitID   string
+	CommitURL  template.URL
+	Summary    string
+	When       string
+	Author     *git.Signature
+	Entry      *git.TreeEntry
+	Crumbs     []*breadcrumb
+	// set when a blame page was generated for the file
+	BlameURL   template.URL
+	HistoryURL template.URL
+	// original blob bytes
+	RawURL template.URL
+	// image, audio, video or pdf when the file page can embed it
+	Media string
+	// what the file page embeds, svgs are inlined since their raw file is
+	// served as text
+	MediaURL template.URL
+	// dimensions of an image, zero when unknown
+	Width  int
+	Height int
+	// set when the entry is a submodule
+	Submodule *submoduleData
+	// set when the entry is a symlink
+	Symlink *symlinkData
+	// e.g. `-rwxr-xr-x`
+	Mode string
+}
+
+type diffRender struct {
+	NumFiles       int
+	TotalAdditions int
+	TotalDeletions int
+	Files          []*diffRenderFile
+	// the full patch, only written when a diff was truncated
+	PatchURL template.URL
+	// only the first `--max-diff-files` files are shown
+	TruncatedFiles bool
+}
+
+type diffRenderFile struct {
+	FileType     string
+	OldMode      git.EntryMode
+	OldName      string
+	Mode         git.EntryMode
+	Name         string
+	Hunks        []*diffHunk
+	NumAdditions int
+	NumDeletions int
+	// only the first `--max-diff-lines` lines are shown
+	Truncated bool
+	// set instead of hunks when the file is a submodule
+	Submodule *submoduleChange
+	// the mode changed, e.g. the file became executable
+	ModeChanged bool
+}
+
+type refInfo struct {
+	ID       string
+	Refspec  string
+	URL      template.URL
+	IsBranch bool
+	IsTag    bool
+	// release data when the ref is a tag
+	Tag *tagData
+	// set when we write archives of the ref
+	Archive *archiveData
+}
+
+type branchOutput struct {
+	Readme     string
+	LastCommit *git.Commit
+	Logs       []*commitData
+}
+
+type siteURLs struct {
+	HomeURL     template.URL
+	CloneURL    template.URL
+	SummaryURL  template.URL
+	RefsURL     template.URL
+	ReleasesURL template.URL
+	FeedURL     template.URL
+	// feed of tags, next to the releases page
+	ReleasesFeedURL template.URL
+}
+
+type pageData struct {
+	Repo     *config
+	SiteURLs *siteURLs
+	RevData  *revData
+}
+
+type summaryPageData struct {
+	*pageData
+	Readme template.HTML
+}
+
+type treePageData struct {
+	*pageData
+	Tree *treeRoot
+}
+
+type logPageData struct {
+	*pageData
+	NumCommits int
+	Logs       []*commitData
+	// pages are numbered from the oldest commit so their urls do not change
+	// when new commits arrive
+	Page     int
+	NumPages int
+	NewerURL template.URL
+	OlderURL template.URL
+}
+
+type filePageData struct {
+	*pageData
+	Contents template.HTML
+	// rendered html when the file is markdown
+	Markdown template.HTML
+	Item     *treeItem
+	// the file is over `--max-file-size` and only has a raw link
+	TooLarge bool
+	// set when only the first lines of the file are shown
+	ShownLines int
+}
+
+type parentData struct {
+	ID      string
+	ShortID string
+	URL     template.URL
+}
+
+type commitPageData struct {
+	*pageData
+	CommitMsg template.HTML
+	CommitID  string
+	Commit    *commitData
+	Diff      *diffRender
+	// every parent of the commit, the diff is against the first one
+	Parents   []*parentData
+	CommitURL template.URL
+	// `git show --cc` for merge commits when enabled
+	CombinedDiff template.HTML
+	// the combined diff was cut at `--max-diff-files` or `--max-diff-lines`
+	CombinedTruncated bool
+}
+
+type refPageData struct {
+	*pageData
+	Refs     []*refInfo
+	Branches []*refInfo
+	Tags     []*refInfo
+	// revisions that are neither branches nor tags
+	Revs []*refInfo
+}
+
+type writeData struct {
+	Template string
+	Filename string
+	Subdir   string
+	Data     any
+}
+
+func diffFileType(_type git.DiffFileType) string {
+	switch _type {
+	case git.DiffFileAdd:
+		return "A"
+	case git.DiffFileChange:
+		return "M"
+	case git.DiffFileDelete:
+		return "D"
+	case git.DiffFileRename:
+		return "R"
+	default:
+		return ""
+	}
+}
+
+// finds the lexer for a file by name, falling back to its contents.
+func getLexer(filename string, text string) chroma.Lexer {
+	lexer := lexers.Match(filename)
+	if lexer == nil {
+		lexer = lexers.Analyse(text)
+	}
+	if lexer == nil {
+		lexer = lexers.Get("plaintext")
+	}
+	return lexer
+}
+
+// converts contents of files in git tree to pretty formatted code.
+func (c *config) parseText(filename string, text string) (string, error) {
+	lexer := getLexer(filename, text)
+	iterator, err := lexer.Tokenise(nil, text)
+	if err != nil {
+		return text, err
+	}
+	var buf bytes.Buffer
+	err = c.Formatter.Format(&buf, c.Theme, iterator)
+	if err != nil {
+		return text, err
+	}
+	return buf.String(), nil
+}
+
+// isText reports whether a significant prefix of s looks like correct UTF-8;
+// that is, if it is likely that s is human-readable text.
+func isText(s string) bool {
+	const max = 1024 // at least utf8.UTFMax
+	if len(s) > max {
+		s = s[0:max]
+	}
+	for i, c := range s {
+		if i+utf8.UTFMax > len(s) {
+			// last char may be incomplete - ignore
+			break
+		}
+		if c == 0xFFFD || c < ' ' && c != '\n' && c != '\t' && c != '\f' && c != '\r' {
+			// decoding error or control character - not a text file
+			return false
+		}
+	}
+	return true
+}
+
+// isTextFile reports whether the file has a known extension indicating
+// a text file, or if a significant chunk of the specified file looks like
+// correct UTF-8; that is, if it is likely that the file contains human-
+// readable text.
+func isTextFile(text string) bool {
+	num := math.Min(float64(len(text)), 1024)
+	return isText(text[0:int(num)])
+}
+
+func toPretty(b int64) string {
+	return humanize.Bytes(uint64(b))
+}
+
+func repoName(root string) string {
+	_, file := filepath.Split(root)
+	return file
+}
+
+func readmeFile(repo *config) string {
+	if repo.Readme == "" {
+		return "readme.md"
+	}
+
+	return strings.ToLower(repo.Readme)
+}
+
+// parseTemplates parses every page template along with the partials and
+// layout once so a broken template stops the build before we write anything.
+func (c *config) parseTemplates() error {
+	fsys := c.templateFS()
+	pages, err := fs.Glob(fsys, "*.page.tmpl")
+	if err != nil {
+		return err
+	}
+
+	c.Templates = map[string]*template.Template{}
+	for _, page := range pages {
+		ts, err := template.ParseFS(
+			fsys,
+			page,
+			"*.partial.tmpl",
+			"base.layout.tmpl",
+		)
+		if err != nil {
+			return err
+		}
+		c.Templates[page] = ts
+	}
+	return nil
+}
+
+func (c *config) writeHtml(writeData *writeData) error {
+	ts, ok := c.Templates[writeData.Template]
+	if !ok {
+		return fmt.Errorf("template not found: %s", writeData.Template)
+	}
+
+	dir := filepath.Join(c.Outdir, writeData.Subdir)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	fp := filepath.Join(dir, writeData.Filename)
+	c.Logger.Info("writing", "filepath", fp)
+
+	f, err := os.OpenFile(fp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// templates write in small pieces so we buffer them on the way to disk
+	w := bufio.NewWriter(f)
+	err = ts.Execute(w, writeData.Data)
+	if err != nil {
+		return err
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	c.Report.addRendered(fp)
+	return nil
+}
+
+func (c *config) copyStatic() error {
+	fsys := c.assetFS()
+	return fs.WalkDir(fsys, ".", func(infp string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		w, err := fs.ReadFile(fsys, infp)
+		if err != nil {
+			return err
+		}
+		fp := filepath.Join(c.Outdir, infp)
+		err = os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		c.Logger.Info("writing", "filepath", fp)
+		return os.WriteFile(fp, w, 0644)
+	})
+}
+
+// writeAssets writes the static assets shared by every page.
+func (c *config) writeAssets() error {
+	err := os.MkdirAll(c.Outdir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	err = c.copyStatic()
+	if err != nil {
+		return err
+	}
+
+	styles := style(*c.Theme)
+	err = os.WriteFile(filepath.Join(c.Outdir, "vars.css"), []byte(styles), 0644)
+	if err != nil {
+		return err
+	}
+
+	fp := filepath.Join(c.Outdir, "syntax.css")
+	w, err := os.OpenFile(fp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return c.Formatter.WriteCSS(w, c.Theme)
+}
+
+func (c *config) writeRootSummary(data *pageData, readme template.HTML) error {
+	c.Logger.Info("writing root html", "repoPath", c.RepoPath)
+	return c.writeHtml(&writeData{
+		Filename: "index.html",
+		Template: "summary.page.tmpl",
+		Data: &summaryPageData{
+			pageData: data,
+			Readme:   readme,
+		},
+	})
+}
+
+func (c *config) writeTree(data *pageData, tree *treeRoot) error {
+	c.Logger.Info("writing tree", "treePath", tree.Path)
+	return c.writeHtml(&writeData{
+		Filename: "index.html",
+		Subdir:   tree.Path,
+		Template: "tree.page.tmpl",
+		Data: &treePageData{
+			pageData: data,
+			Tree:     tree,
+		},
+	})
+}
+
+// logPage is the range of loaded commits, newest first, shown on a page of the
+// log.
+type logPage struct {
+	Page  int
+	Start int
+	End   int
+}
+
+// getLogPages splits `loaded` commits, the newest ones out of `total`, into
+// pages of `size`. Pages are numbered from the oldest commit so every page
+// but the newest is full and keeps its commits as new ones are added.
+//
+// This only holds while history is linear: a merge can list older commits
+// between existing ones and a force push rewrites them, both shift every page
+// after them.
+func getLogPages(total, loaded, size int) []logPage {
+	numPages := max((total+size-1)/size, 1)
+
+	pages := []logPage{}
+	start := 0
+	for page := numPages; page >= 1 && start < loaded; page-- {
+		count := size
+		if page == numPages {
+			count = total - (page-1)*size
+		}
+		end := min(start+count, loaded)
+		pages = append(pages, logPage{Page: page, Start: start, End: end})
+		start = end
+	}
+	return pages
+}
+
+// writeLog splits the commits of a revision into pages. `total` is the number
+// of commits in the revision which can be more than we loaded.
+func (c *config) writeLog(data *pageData, logs []*commitData, total int) error {
+	c.Logger.Info("writing log file", "revision", data.RevData.Name())
+	size := c.getLogPageSize()
+	numPages := max((total+size-1)/size, 1)
+
+	for _, bounds := range getLogPages(total, len(logs), size) {
+		page := bounds.Page
+		pageData := &logPageData{
+			pageData:   data,
+			NumCommits: total,
+			Logs:       logs[bounds.Start:bounds.End],
+			Page:       page,
+			NumPages:   numPages,
+		}
+		if page < numPages {
+			pageData.NewerURL = c.getLogPageURL(data.RevData, page+1)
+		}
+		if page > 1 && bounds.End < len(logs) {
+			pageData.OlderURL = c.getLogPageURL(data.RevData, page-1)
+		}
+
+		err := c.writeHtml(&writeData{
+			Filename: fmt.Sprintf("%d.html", page),
+			Subdir:   getLogPageDir(data.RevData),
+			Template: "log.page.tmpl",
+			Data:     pageData,
+		})
+		if err != nil {
+			return err
+		}
+
+		// the log index is always the newest page
+		if page == numPages {
+			err = c.writeHtml(&writeData{
+				Filename: "index.html",
+				Subdir:   getLogBaseDir(data.RevData),
+				Template: "log.page.tmpl",
+				Data:     pageData,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *config) writeRefs(data *pageData, refs []*refInfo, tags []*tagData) error {
+	c.Logger.Info("writing refs", "repoPath", c.RepoPath)
+	pageData := &refPageData{
+		pageData: data,
+		Refs:     refs,
+	}
+	for _, ref := range refs {
+		if ref.IsBranch {
+			pageData.Branches = append(pageData.Branches, ref)
+		} else if !ref.IsTag {
+			pageData.Revs = append(pageData.Revs, ref)
+		}
+	}
+	// tags are displayed in the same order as releases
+	for _, tag := range tags {
+		for _, ref := range refs {
+			if ref.Tag == tag {
+				pageData.Tags = append(pageData.Tags, ref)
+			}
+		}
+	}
+
+	return c.writeHtml(&writeData{
+		Filename: "refs.html",
+		Template: "refs.page.tmpl",
+		Data:     pageData,
+	})
+}
+
+func (c *config) writeHTMLTreeFile(repo *git.Repository, pageData *pageData, treeItem *treeItem, history *revHistory, search *searchCollector) (string, error) {
+	readme := ""
+	d := filepath.Dir(treeItem.Path)
+	nameLower := strings.ToLower(treeItem.Entry.Name())
+	summary := readmeFile(pageData.Repo)
+	isReadme := d == "." && nameLower == summary
+
+	revName := pageData.RevData.Name()
+	blobID := treeItem.Entry.ID().String()
+	fname := fmt.Sprintf("%s.html", treeItem.Entry.Name())
+	subdir := getFileDir(pageData.RevData, d)
+
+	// a file can keep its blob while its history changes, e.g. a change that
+	// was reverted, and the history is already read so we always write it
+	if history != nil {
+		err := c.writeHistory(repo, pageData, treeItem, history)
+		err = c.reportErr(err, revName, string(treeItem.HistoryURL))
+		if err != nil {
+			return readme, err
+		}
+	}
+
+	// we always need the readme for the summary page
+	prev := c.Manifest.getBlob(revName, treeItem.Path, &blobInfo{
+		ID:       blobID,
+		Mode:     treeItem.Mode,
+		CommitID: treeItem.CommitID,
+	})
+	if !isReadme && prev != nil && c.blobPagesExist(pageData.RevData, treeItem.Path, prev) {
+		c.Logger.Info("file unchanged since last build, skipping", "filepath", treeItem.Path)
+		treeItem.IsTextFile = prev.IsTextFile
+		treeItem.NumLines = prev.NumLines
+		treeItem.Width = prev.Width
+		treeItem.Height = prev.Height
+		if prev.Blame {
+			treeItem.BlameURL = c.getFileURL(pageData.RevData, getBlameFilename(treeItem.Path))
+		}
+		c.Manifest.addBlob(revName, treeItem.Path, prev)
+
+		if c.SearchCode && treeItem.IsTextFile && treeItem.Entry.Size() <= maxSearchFileSize {
+			b, err := treeItem.Entry.Blob().Bytes()
+			if err != nil {
+				return readme, err
+			}
+			search.addText(treeItem.Path, string(b))
+		}
+		return readme, nil
+	}
+
+	// the file page is still written without the image or its dimensions
+	err := c.readMedia(treeItem)
+	err = c.reportErr(err, revName, treeItem.Path)
+	if err != nil {
+		return readme, err
+	}
+
+	rawPath, err := c.writeRaw(pageData, treeItem)
+	if err != nil {
+		return readme, err
+	}
+
+	// we only need enough of a file that is too large to tell if it is text
+	tooLarge := c.isTooLarge(treeItem.Entry.Size())
+	var b []byte
+	if tooLarge {
+		b, err = readHead(rawPath, 1024)
+	} else {
+		b, err = os.ReadFile(rawPath)
+	}
+	if err != nil {
+		return readme, err
+	}
+	str := string(b)
+
+	// a symlink only holds its target which the page shows on its own
+	treeItem.IsTextFile = isTextFile(str) && treeItem.Symlink == nil
+
+	contents := ""
+	markdown := ""
+	shownLines := 0
+	if treeItem.IsTextFile && tooLarge {
+		treeItem.NumLines, err = countLines(rawPath)
+		if err != nil {
+			return readme, err
+		}
+	} else if treeItem.IsTextFile {
+		treeItem.NumLines = len(strings.Split(str, "\n"))
+		if c.SearchCode {
+			search.addText(treeItem.Path, str)
+		}
+
+		text, truncated := c.truncateLines(str)
+		if truncated {
+			shownLines = c.MaxFileLines
+		}
+		contents, err = c.parseText(treeItem.Entry.Name(), text)
+		if err != nil {
+			return readme, err
+		}
+
+		if isMarkdownFile(treeItem.Entry.Name()) && !truncated {
+			markdown, err = c.parseMarkdown(str)
+			if err != nil {
+				return readme, err
+			}
+		}
+
+		// the file page is still useful without its blame page
+		if c.Blame && !truncated {
+			err = c.writeBlame(repo, pageData, treeItem, str)
+			err = c.reportErr(err, revName, getBlameFilename(treeItem.Path))
+			if err != nil {
+				return readme, err
+			}
+		}
+	}
+
+	if isReadme {
+		readme = contents
+		if markdown != "" {
+			readme = markdown
+		}
+	}
+
+	err = c.writeHtml(&writeData{
+		Filename: fname,
+		Template: "file.page.tmpl",
+		Data: &filePageData{
+			pageData:   pageData,
+			Contents:   template.HTML(contents),
+			Markdown:   template.HTML(markdown),
+			Item:       treeItem,
+			TooLarge:   tooLarge,
+			ShownLines: shownLines,
+		},
+		Subdir: subdir,
+	})
+	if err != nil {
+		return readme, err
+	}
+
+	c.Manifest.addBlob(revName, treeItem.Path, &blobInfo{
+		ID:         blobID,
+		Mode:       treeItem.Mode,
+		CommitID:   treeItem.CommitID,
+		IsTextFile: treeItem.IsTextFile,
+		NumLines:   treeItem.NumLines,
+		Width:      treeItem.Width,
+		Height:     treeItem.Height,
+		Blame:      treeItem.BlameURL != "",
+	})
+	return readme, nil
+}
+
+// blobPagesExist checks that every page the last build wrote for a file is
+// still in the output directory.
+func (c *config) blobPagesExist(info revInfo, fpath string, prev *blobInfo) bool {
+	subdir := getFileDir(info, filepath.Dir(fpath))
+	name := filepath.Base(fpath)
+	paths := []string{
+		filepath.Join(subdir, fmt.Sprintf("%s.html", name)),
+		filepath.Join(getRawBaseDir(info), getRawFilename(fpath)),
+	}
+	if prev.Blame {
+		paths = append(paths, filepath.Join(subdir, getBlameFilename(name)))
+	}
+	for _, fp := range paths {
+		if !fileExists(filepath.Join(c.Outdir, fp)) {
+			return false
+		}
+	}
+	return true
+}
+
+// revPagesExist checks that every file page the last build wrote for a rev,
+// along with its history page, is still in the output directory.
+func (c *config) revPagesExist(info revInfo) bool {
+	for fpath, prev := range c.Manifest.getRevBlobs(info.Name()) {
+		if !c.blobPagesExist(info, fpath, prev) {
+			return false
+		}
+		if c.NoHistory {
+			continue
+		}
+		dir, fname := getHistoryFile(fpath, false)
+		if !fileExists(filepath.Join(c.Outdir, getHistoryBaseDir(info), dir, fname)) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRaw streams the original blob bytes to a file so files can be
+// downloaded and returns its path.
+func (c *config) writeRaw(pageData *pageData, treeItem *treeItem) (string, error) {
+	fp := filepath.Join(c.Outdir, getRawBaseDir(pageData.RevData), getRawFilename(treeItem.Path))
+	err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+	if err != nil {
+		return fp, err
+	}
+
+	c.Logger.Info("writing", "filepath", fp)
+	f, err := os.Create(fp)
+	if err != nil {
+		return fp, err
+	}
+
+	stderr := new(bytes.Buffer)
+	err = treeItem.Entry.Blob().Pipeline(f, stderr)
+	if err != nil {
+		_ = f.Close()
+		return fp, fmt.Errorf("%w: %s", err, stderr.String())
+	}
+	return fp, f.Close()
+}
+
+// findReadme renders the readme from the root of a tree without walking it.
+func (c *config) findReadme(tree *git.Tree) (string, error) {
+	entries, err := tree.Entries()
+	if err != nil {
+		return "", err
+	}
+
+	summary := readmeFile(c)
+	for _, entry := range entries {
+		if !entry.IsBlob() || strings.ToLower(entry.Name()) != summary {
+			continue
+		}
+
+		if c.isTooLarge(entry.Size()) {
+			return "", nil
+		}
+		b, err := entry.Blob().Bytes()
+		if err != nil {
+			return "", err
+		}
+		str := string(b)
+		if !isTextFile(str) {
+			return "", nil
+		}
+
+		text, truncated := c.truncateLines(str)
+		if isMarkdownFile(entry.Name()) && !truncated {
+			return c.parseMarkdown(str)
+		}
+		return c.parseText(entry.Name(), text)
+	}
+
+	return "", nil
+}
+
+// writeLinkedCommit writes the commit page for a commit we link to outside of
+// the log, e.g. from a history or blame page past `--max-commits`.
+func (c *config) writeLinkedCommit(repo *git.Repository, pageData *pageData, commitID string) error {
+	fp := filepath.Join(c.Outdir, "commits", fmt.Sprintf("%s.html", commitID))
+	if c.Cache.has(commitID) || (c.Manifest.hasCommit(commitID) && fileExists(fp)) {
+		return nil
+	}
+
+	commit, err := repo.CatFileCommit(commitID)
+	if err != nil {
+		return err
+	}
+	return c.writeLogDiff(repo, pageData, c.newCommitData(commit, nil))
+}
+
+func (c *config) writeLogDiff(repo *git.Repository, pageData *pageData, commit *commitData) error {
+	commitID := commit.ID.String()
+
+	if !c.Cache.claim(commitID) {
+		c.Logger.Info("commit file already generated, skipping", "commitID", getShortID(commitID))
+		return nil
+	}
+
+	fp := filepath.Join(c.Outdir, "commits", fmt.Sprintf("%s.html", commitID))
+	if c.Manifest.hasCommit(commitID) && fileExists(fp) {
+		c.Logger.Info("commit unchanged since last build, skipping", "commitID", getShortID(commitID))
+		c.Manifest.addCommit(commitID)
+		return nil
+	}
+
+	// merges are diffed against their first parent and root commits against
+	// the empty tree
+	opts := git.DiffOptions{}
+	if commit.ParentID == "" {
+		opts.Base = emptyTreeID
+	}
+	// we parse one file more than we show to tell if there are more, the
+	// rest of the diff is read but not kept
+	maxFiles := 0
+	if c.MaxDiffFiles > 0 {
+		maxFiles = c.MaxDiffFiles + 1
+	}
+	diff, err := repo.Diff(commitID, maxFiles, c.MaxDiffLines, 0, opts)
+	if err != nil {
+		return err
+	}
+
+	rnd := &diffRender{}
+	files := diff.Files
+	if c.MaxDiffFiles > 0 && len(files) > c.MaxDiffFiles {
+		files = files[:c.MaxDiffFiles]
+		rnd.TruncatedFiles = true
+	}
+	rnd.NumFiles = len(files)
+	for _, file := range files {
+		rnd.TotalAdditions += file.NumAdditions()
+		rnd.TotalDeletions += file.NumDeletions()
+	}
+
+	linkPatch := func() error {
+		if rnd.PatchURL != "" {
+			return nil
+		}
+		err := c.writePatch(repo, commitID, opts.Base)
+		err = c.reportErr(err, commitID, "patch")
+		if err != nil {
+			return err
+		}
+		rnd.PatchURL = c.getPatchURL(commitID)
+		return nil
+	}
+	if rnd.TruncatedFiles {
+		err = linkPatch()
+		if err != nil {
+			return err
+		}
+	}
+
+	fls := []*diffRenderFile{}
+	for _, file := range files {
+		if isSubmoduleDiff(file) {
+			fls = append(fls, &diffRenderFile{
+				FileType:  diffFileType(file.Type),
+				OldName:   file.OldName(),
+				Name:      file.Name,
+				Submodule: newSubmoduleChange(commit.Commit, file),
+			})
+			continue
+		}
+
+		fl := &diffRenderFile{
+			FileType:     diffFileType(file.Type),
+			OldMode:      file.OldMode(),
+			OldName:      file.OldName(),
+			Mode:         file.Mode(),
+			Name:         file.Name,
+			NumAdditions: file.NumAdditions(),
+			NumDeletions: file.NumDeletions(),
+			Truncated:    c.truncateDiff(file),
+			ModeChanged:  isModeChange(file),
+		}
+		if fl.Truncated {
+			err = linkPatch()
+			if err != nil {
+				return err
+			}
+		}
+
+		// pages for the file before and after the commit so line numbers
+		// in the diff can link to them
+		var oldURL, newURL template.URL
+		hasPages := c.CommitFiles && len(file.Sections) > 0 && !file.IsBinary() && !file.IsSubmodule()
+		if hasPages && file.Type != git.DiffFileDelete && isFileMode(file.Mode()) {
+			newURL, err = c.writeCommitFile(repo, pageData, commitID, file.Name)
+			err = c.reportErr(err, commitID, file.Name)
+			if err != nil {
+				return err
+			}
+		}
+		if hasPages && file.Type != git.DiffFileAdd && isFileMode(file.OldMode()) && commit.ParentID != "" {
+			oldName := file.Name
+			if file.IsRenamed() {
+				oldName = file.OldName()
+			}
+			oldURL, err = c.writeCommitFile(repo, pageData, commit.ParentID, oldName)
+			err = c.reportErr(err, commit.ParentID, oldName)
+			if err != nil {
+				return err
+			}
+		}
+
+		fl.Hunks, err = renderHunks(file, oldURL, newURL, c.MaxFileLines)
+		if err != nil {
+			return err
+		}
+		fls = append(fls, fl)
+	}
+	rnd.Files = fls
+
+	parents := []*parentData{}
+	for i := 0; i < commit.ParentsCount(); i++ {
+		parentID, err := commit.Commit.ParentID(i)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, &parentData{
+			ID:      parentID.String(),
+			ShortID: getShortID(parentID.String()),
+			URL:     c.getCommitURL(parentID.String()),
+		})
+	}
+
+	commitData := &commitPageData{
+		pageData:  pageData,
+		Commit:    commit,
+		CommitID:  getShortID(commitID),
+		Diff:      rnd,
+		Parents:   parents,
+		CommitURL: c.getCommitURL(commitID),
+	}
+
+	if c.CombinedDiff && len(parents) > 1 {
+		combined, truncated, err := c.combinedDiff(repo, commitID)
+		err = c.reportErr(err, commitID, "")
+		if err != nil {
+			return err
+		}
+		commitData.CombinedDiff = template.HTML(combined)
+		commitData.CombinedTruncated = truncated
+	}
+
+	err = c.writeHtml(&writeData{
+		Filename: fmt.Sprintf("%s.html", commitID),
+		Template: "commit.page.tmpl",
+		Subdir:   "commits",
+		Data:     commitData,
+	})
+	if err != nil {
+		return err
+	}
+	c.Manifest.addCommit(commitID)
+	return nil
+}
+
+func (c *config) getSummaryURL() template.URL {
+	url := c.RootRelative + "index.html"
+	return template.URL(url)
+}
+
+func (c *config) getFeedURL() template.URL {
+	url := c.RootRelative + "atom.xml"
+	return template.URL(url)
+}
+
+func (c *config) getRefsURL() template.URL {
+	url := c.RootRelative + "refs.html"
+	return template.URL(url)
+}
+
+// controls the url for trees and logs
+// - /logs/getRevIDForURL()/index.html
+// - /tree/getRevIDForURL()/item/file.x.html.
+func getRevIDForURL(info revInfo) string {
+	return info.Name()
+}
+
+func getTreeBaseDir(info revInfo) string {
+	subdir := getRevIDForURL(info)
+	return filepath.Join("/", "tree", subdir)
+}
+
+func getLogBaseDir(info revInfo) string {
+	subdir := getRevIDForURL(info)
+	return filepath.Join("/", "logs", subdir)
+}
+
+// controls the url for log pages
+// - /logs/getRevIDForURL()/page/1.html is the page with the oldest commits.
+func getLogPageDir(info revInfo) string {
+	return filepath.Join(getLogBaseDir(info), "page")
+}
+
+func getRawBaseDir(info revInfo) string {
+	subdir := getRevIDForURL(info)
+	return filepath.Join("/", "raw", subdir)
+}
+
+func getFileBaseDir(info revInfo) string {
+	return filepath.Join(getTreeBaseDir(info), "item")
+}
+
+func getFileDir(info revInfo, fname string) string {
+	return filepath.Join(getFileBaseDir(info), fname)
+}
+
+// rawSuffix is added to raw files that a browser would open as a page, their
+// scripts would run on the origin of the site.
+const rawSuffix = ".txt"
+
+// activeExts are the extensions browsers render as a document that can run
+// scripts.
+var activeExts = map[string]bool{
+	".htm":   true,
+	".html":  true,
+	".shtml": true,
+	".xht":   true,
+	".xhtml": true,
+	".xml":   true,
+	".xsl":   true,
+	".xslt":  true,
+	".svg":   true,
+	".svgz":  true,
+	".mht":   true,
+	".mhtml": true,
+}
+
+// getRawFilename is where the raw file is written, `index.html` becomes
+// `index.html.txt` so it is served as plain text.
+func getRawFilename(fpath string) string {
+	if activeExts[strings.ToLower(filepath.Ext(fpath))] {
+		return fpath + rawSuffix
+	}
+	return fpath
+}
+
+func (c *config) getRawURL(info revInfo, fname string) template.URL {
+	return c.compileURL(getRawBaseDir(info), getRawFilename(fname))
+}
+
+func (c *config) getFileURL(info revInfo, fname string) template.URL {
+	return c.compileURL(getFileBaseDir(info), fname)
+}
+
+func (c *config) compileURL(dir, fname string) template.URL {
+	purl := c.RootRelative + strings.TrimPrefix(dir, "/")
+	url := filepath.Join(purl, fname)
+	return template.URL(url)
+}
+
+func (c *config) getTreeURL(info revInfo) template.URL {
+	dir := getTreeBaseDir(info)
+	return c.compileURL(dir, "index.html")
+}
+
+func (c *config) getLogsURL(info revInfo) template.URL {
+	dir := getLogBaseDir(info)
+	return c.compileURL(dir, "index.html")
+}
+
+func (c *config) getLogPageURL(info revInfo, page int) template.URL {
+	return c.compileURL(getLogPageDir(info), fmt.Sprintf("%d.html", page))
+}
+
+func (c *config) getCommitURL(commitID string) template.URL {
+	url := fmt.Sprintf("%scommits/%s.html", c.RootRelative, commitID)
+	return template.URL(url)
+}
+
+func (c *config) getURLs() *siteURLs {
+	return &siteURLs{
+		HomeURL:         c.HomeURL,
+		CloneURL:        c.CloneURL,
+		RefsURL:         c.getRefsURL(),
+		ReleasesURL:     c.getReleasesURL(),
+		SummaryURL:      c.getSummaryURL(),
+		FeedURL:         c.getFeedURL(),
+		ReleasesFeedURL: c.getReleasesFeedURL(),
+	}
+}
+
+// getMaxCommits returns 0 when there is no limit, same as `git log`.
+func (c *config) getMaxCommits() int {
+	if c.MaxCommits < 0 {
+		return 0
+	}
+	if c.MaxCommits == 0 {
+		return 5000
+	}
+	return c.MaxCommits
+}
+
+func (c *config) getLogPageSize() int {
+	if c.LogPageSize <= 0 {
+		return 100
+	}
+	return c.LogPageSize
+}
+
+// getNumLogs returns how many commits to load out of `total` so the oldest
+// log page we render is complete. Pages are numbered from the oldest commit
+// so only the newest page can be partial.
+func (c *config) getNumLogs(total int) int {
+	maxCommits := c.getMaxCommits()
+	if maxCommits == 0 || maxCommits >= total {
+		return total
+	}
+
+	size := c.getLogPageSize()
+	newest := total % size
+	if newest == 0 {
+		newest = size
+	}
+	if maxCommits <= newest {
+		return newest
+	}
+	pages := (maxCommits - newest + size - 1) / size
+	return min(total, newest+pages*size)
+}
+
+func getShortID(id string) string {
+	return id[:7]
+}
+
+func (c *config) writeRepo() (*branchOutput, error) {
+	c.Logger.Info("writing repo", "repoPath", c.RepoPath)
+	repo, err := git.Open(c.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Manifest, err = c.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	c.LastCommits, err = c.loadLastCommitCache()
+	if err != nil {
+		return nil, err
+	}
+
+	// dereference annotated tags so we know which commit they point to
+	refs, err := repo.ShowRef(git.ShowRefOptions{
+		Heads:          true,
+		Tags:           true,
+		CommandOptions: git.CommandOptions{Args: []string{"--dereference"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var first *revData
+	revs := []*revData{}
+	for _, revStr := range c.Revs {
+		fullRevID, err := repo.RevParse(revStr)
+		if err != nil {
+			err = c.reportErr(err, revStr, "")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		revID := getShortID(fullRevID)
+		revName := revID
+		// if it's a reference then label it as such
+		for _, ref := range refs {
+			if revStr == git.RefShortName(ref.Refspec) || revStr == ref.Refspec {
+				revName = revStr
+				break
+			}
+		}
+
+		data := &revData{
+			id:     fullRevID,
+			name:   revName,
+			Config: c,
+		}
+
+		if first == nil {
+			first = data
+		}
+		revs = append(revs, data)
+	}
+
+	if first == nil {
+		return nil, fmt.Errorf("could find find a git reference that matches criteria")
+	}
+
+	refInfoMap := map[string]*refInfo{}
+	for _, revData := range revs {
+		refInfoMap[revData.Name()] = &refInfo{
+			ID:      revData.ID(),
+			Refspec: revData.Name(),
+			URL:     revData.TreeURL(),
+			Archive: revData.Archive(),
+		}
+	}
+
+	// loop through ALL refs that don't have URLs
+	// and add them to the map
+	for _, ref := range refs {
+		refspec := git.RefShortName(ref.Refspec)
+		// the commit an annotated tag points to
+		if strings.HasSuffix(refspec, "^{}") {
+			continue
+		}
+
+		info := refInfoMap[refspec]
+		if info == nil {
+			info = &refInfo{
+				ID:      ref.ID,
+				Refspec: refspec,
+			}
+			refInfoMap[refspec] = info
+		}
+		info.IsBranch = strings.HasPrefix(ref.Refspec, git.RefsHeads)
+		info.IsTag = strings.HasPrefix(ref.Refspec, git.RefsTags)
+	}
+
+	// use the commit id for annotated tags
+	for _, ref := range refs {
+		refspec := strings.TrimSuffix(git.RefShortName(ref.Refspec), "^{}")
+		if refspec != git.RefShortName(ref.Refspec) && refInfoMap[refspec] != nil {
+			refInfoMap[refspec].ID = ref.ID
+		}
+	}
+
+	// gather lists of refs to display on refs.html page
+	refInfoList := []*refInfo{}
+	for _, val := range refInfoMap {
+		refInfoList = append(refInfoList, val)
+	}
+	sort.Slice(refInfoList, func(i, j int) bool {
+		urlI := refInfoList[i].URL
+		urlJ := refInfoList[j].URL
+		refI := refInfoList[i].Refspec
+		refJ := refInfoList[j].Refspec
+		if urlI == urlJ {
+			return refI < refJ
+		}
+		return urlI > urlJ
+	})
+
+	// we assume the first revision in the list is the "main" revision which mostly
+	// means that's the README we use for the default summary page.
+	mainOutput := &branchOutput{}
+	var eg errgroup.Group
+	for i, revData := range revs {
+		c.Logger.Info("writing revision", "revision", revData.Name())
+		data := &pageData{
+			Repo:     c,
+			RevData:  revData,
+			SiteURLs: c.getURLs(),
+		}
+
+		if i == 0 {
+			branchOutput, err := c.writeRevision(repo, data, refInfoList)
+			err = c.reportErr(err, revData.Name(), "")
+			if err != nil {
+				return nil, err
+			}
+			if branchOutput != nil {
+				mainOutput = branchOutput
+			}
+		} else {
+			eg.Go(func() error {
+				_, err := c.writeRevision(repo, data, refInfoList)
+				return c.reportErr(err, revData.Name(), "")
+			})
+		}
+	}
+	err = eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// use the first revision in our list to generate
+	// the root summary, logs, and tree the user can click
+	rev := &revData{
+		id:     first.ID(),
+		name:   first.Name(),
+		Config: c,
+	}
+
+	data := &pageData{
+		RevData:  rev,
+		Repo:     c,
+		SiteURLs: c.getURLs(),
+	}
+	tags, err := c.loadTags(repo, refInfoList)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		info := refInfoMap[tag.Name]
+		if info == nil {
+			continue
+		}
+		info.Tag = tag
+		if c.ArchiveTags && info.Archive == nil {
+			info.Archive = c.getArchive(tag.Name)
+		}
+		tag.Archive = info.Archive
+	}
+
+	if c.Archives {
+		err = c.writeArchives(repo, revs, tags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = c.writeReleases(repo, data, tags, refInfoList)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.reportErr(c.writeRefs(data, refInfoList, tags), "", "refs.html")
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.writeRootSummary(data, template.HTML(mainOutput.Readme))
+	err = c.reportErr(err, "", "index.html")
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.reportErr(c.writeLogFeed(data, mainOutput.Logs, "/"), "", "atom.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.reportErr(c.writeCustomPages(data), "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.saveManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.saveLastCommitCache()
+	if err != nil {
+		return nil, err
+	}
+	return mainOutput, nil
+}
+
+type treeRoot struct {
+	Path   string
+	Items  []*treeItem
+	Crumbs []*breadcrumb
+}
+
+type treeWalker struct {
+	treeItem chan *treeItem
+	tree     chan *treeRoot
+	// nil when the latest commit per file is hidden
+	LastCommits *revLastCommits
+	// nil when history pages are disabled
+	History  *revHistory
+	PageData *pageData
+	Repo     *git.Repository
+	Config   *config
+	// tree of the revision, used to resolve symlinks
+	Root *git.Tree
+}
+
+type breadcrumb struct {
+	Text   string
+	URL    template.URL
+	IsLast bool
+}
+
+func (tw *treeWalker) calcBreadcrumbs(curpath string) []*breadcrumb {
+	if curpath == "" {
+		return []*breadcrumb{}
+	}
+	parts := strings.Split(curpath, string(os.PathSeparator))
+	rootURL := tw.Config.compileURL(
+		getTreeBaseDir(tw.PageData.RevData),
+		"index.html",
+	)
+
+	crumbs := make([]*breadcrumb, len(parts)+1)
+	crumbs[0] = &breadcrumb{
+		URL:  rootURL,
+		Text: tw.PageData.Repo.RepoName,
+	}
+
+	cur := ""
+	for idx, d := range parts {
+		crumb := filepath.Join(getFileBaseDir(tw.PageData.RevData), cur, d)
+		crumbUrl := tw.Config.compileURL(crumb, "index.html")
+		crumbs[idx+1] = &breadcrumb{
+			Text: d,
+			URL:  crumbUrl,
+		}
+		if idx == len(parts)-1 {
+			crumbs[idx+1].IsLast = true
+		}
+		cur = filepath.Join(cur, d)
+	}
+
+	return crumbs
+}
+
+func filenameToDevIcon(filename string) string {
+	ext := filepath.Ext(filename)
+	extMappr := map[string]string{
+		".html": "html5",
+		".go":   "go",
+		".py":   "python",
+		".css":  "css3",
+		".js":   "javascript",
+		".md":   "markdown",
+		".ts":   "typescript",
+		".tsx":  "react",
+		".jsx":  "react",
+	}
+
+	nameMappr := map[string]string{
+		"Makefile":   "cmake",
+		"Dockerfile": "docker",
+	}
+
+	icon := extMappr[ext]
+	if icon == "" {
+		icon = nameMappr[filename]
+	}
+
+	return fmt.Sprintf("devicon-%s-original", icon)
+}
+
+func (tw *treeWalker) newTreeItem(entry *git.TreeEntry, curpath string, crumbs []*breadcrumb) (*treeItem, error) {
+	typ := entry.Type()
+	fname := filepath.Join(curpath, entry.Name())
+	item := &treeItem{
+		Size:   toPretty(entry.Size()),
+		Name:   entry.Name(),
+		Path:   fname,
+		Entry:  entry,
+		Mode:   modeString(entry.Mode()),
+		URL:    tw.Config.getFileURL(tw.PageData.RevData, fname),
+		Crumbs: crumbs,
+		Author: &git.Signature{
+			Name: "unknown",
+		},
+	}
+
+	if tw.LastCommits != nil {
+		if lc := tw.LastCommits.get(item.Path); lc != nil {
+			item.CommitURL = tw.Config.getCommitURL(lc.ID)
+			item.CommitID = getShortID(lc.ID)
+			item.Summary = lc.Summary
+			item.When = lc.When.Format(time.DateOnly)
+			item.Author = &git.Signature{
+				Name:  lc.Author,
+				Email: lc.Email,
+				When:  lc.When,
+			}
+		}
+	}
+
+	fpath := tw.Config.getFileURL(tw.PageData.RevData, fmt.Sprintf("%s.html", fname))
+	switch typ {
+	case git.ObjectTree:
+		item.IsDir = true
+		fpath = tw.Config.compileURL(
+			filepath.Join(
+				getFileBaseDir(tw.PageData.RevData),
+				curpath,
+				entry.Name(),
+			),
+			"index.html",
+		)
+	case git.ObjectBlob:
+		item.Icon = filenameToDevIcon(item.Name)
+		item.RawURL = tw.Config.getRawURL(tw.PageData.RevData, item.Path)
+		if entry.IsSymlink() {
+			link, err := tw.newSymlink(item)
+			err = tw.Config.reportErr(err, tw.PageData.RevData.Name(), item.Path)
+			if err != nil {
+				return nil, err
+			}
+			item.Symlink = link
+			break
+		}
+		item.Media = getMediaType(item.Name)
+		item.MediaURL = item.RawURL
+	case git.ObjectCommit:
+		// the submodule is still listed without its url
+		sub, err := tw.newSubmodule(entry, item.Path)
+		err = tw.Config.reportErr(err, tw.PageData.RevData.Name(), item.Path)
+		if err != nil {
+			return nil, err
+		}
+		item.Submodule = sub
+		fpath = sub.Link
+	}
+	item.URL = fpath
+	if tw.History != nil {
+		item.HistoryURL = tw.Config.getHistoryURL(tw.PageData.RevData, item.Path, item.IsDir)
+	}
+
+	return item, nil
+}
+
+// walk sends every item and subtree to the channels. Subtrees we cannot read
+// are reported and skipped so we only return an error when the build should
+// stop.
+func (tw *treeWalker) walk(tree *git.Tree, curpath string) error {
+	entries, err := tree.Entries()
+	if err != nil {
+		return err
+	}
+
+	crumbs := tw.calcBreadcrumbs(curpath)
+	treeEntries := []*treeItem{}
+	for _, entry := range entries {
+		typ := entry.Type()
+		item, err := tw.newTreeItem(entry, curpath, crumbs)
+		if err != nil {
+			return err
+		}
+
+		switch typ {
+		case git.ObjectTree:
+			item.IsDir = true
+			re, err := tree.Subtree(entry.Name())
+			if err == nil {
+				err = tw.walk(re, item.Path)
+			}
+			err = tw.Config.reportErr(err, tw.PageData.RevData.Name(), item.Path)
+			if err != nil {
+				return err
+			}
+			treeEntries = append(treeEntries, item)
+			tw.treeItem <- item
+		case git.ObjectBlob, git.ObjectCommit:
+			treeEntries = append(treeEntries, item)
+			tw.treeItem <- item
+		}
+	}
+
+	sort.Slice(treeEntries, func(i, j int) bool {
+		nameI := treeEntries[i].Name
+		nameJ := treeEntries[j].Name
+		if treeEntries[i].IsDir && treeEntries[j].IsDir {
+			return nameI < nameJ
+		}
+
+		if treeEntries[i].IsDir && !treeEntries[j].IsDir {
+			return true
+		}
+
+		if !treeEntries[i].IsDir && treeEntries[j].IsDir {
+			return false
+		}
+
+		return nameI < nameJ
+	})
+
+	fpath := filepath.Join(
+		getFileBaseDir(tw.PageData.RevData),
+		curpath,
+	)
+	// root gets a special spot outside of `item` subdir
+	if curpath == "" {
+		fpath = getTreeBaseDir(tw.PageData.RevData)
+	}
+
+	tw.tree <- &treeRoot{
+		Path:   fpath,
+		Items:  treeEntries,
+		Crumbs: crumbs,
+	}
+
+	return nil
+}
+
+func (c *config) newCommitData(commit *git.Commit, refs []*refInfo) *commitData {
+	tags := []*refInfo{}
+	for _, ref := range refs {
+		if commit.ID.String() == ref.ID {
+			tags = append(tags, ref)
+		}
+	}
+
+	parentID := ""
+	parentSha, err := commit.ParentID(0)
+	if err == nil {
+		parentID = parentSha.String()
+	}
+	return &commitData{
+		ParentID:   parentID,
+		URL:        c.getCommitURL(commit.ID.String()),
+		ShortID:    getShortID(commit.ID.String()),
+		SummaryStr: commit.Summary(),
+		AuthorStr:  commit.Author.Name,
+		WhenStr:    commit.Author.When.Format(time.DateOnly),
+		Commit:     commit,
+		Refs:       tags,
+	}
+}
+
+// writeRevision writes the log, commits and tree for a revision. Pages that
+// fail are reported and skipped, an error is only returned when we cannot
+// read the revision at all or the build should stop.
+func (c *config) writeRevision(repo *git.Repository, pageData *pageData, refs []*refInfo) (*branchOutput, error) {
+	c.Logger.Info(
+		"compiling revision",
+		"repoName", c.RepoName,
+		"revision", pageData.RevData.Name(),
+	)
+
+	output := &branchOutput{}
+	revName := pageData.RevData.Name()
+	revID := pageData.RevData.ID()
+	search := newSearchCollector()
+
+	var eg errgroup.Group
+
+	eg.Go(func() error {
+		total, err := repo.RevListCount([]string{revID})
+		if err != nil {
+			return err
+		}
+		commits, err := repo.Log(revID, git.LogOptions{
+			MaxCount: c.getNumLogs(int(total)),
+		})
+		if err != nil {
+			return err
+		}
+
+		logs := []*commitData{}
+		for i, commit := range commits {
+			if i == 0 {
+				output.LastCommit = commit
+			}
+
+			logs = append(logs, c.newCommitData(commit, refs))
+		}
+
+		err = c.reportErr(c.writeLog(pageData, logs, int(total)), revName, "logs")
+		if err != nil {
+			return err
+		}
+		feedDir := getLogBaseDir(pageData.RevData)
+		err = c.reportErr(c.writeLogFeed(pageData, logs, feedDir), revName, feedDir)
+		if err != nil {
+			return err
+		}
+		output.Logs = logs
+		search.addCommits(logs)
+
+		for _, cm := range logs {
+			c.Pool.Go(&eg, func() error {
+				err := c.writeLogDiff(repo, pageData, cm)
+				return c.reportErr(err, cm.ID.String(), "")
+			})
+		}
+		return nil
+	})
+
+	tree, err := repo.LsTree(revID)
+	if err != nil {
+		// wait for the log so it does not write after we return
+		_ = eg.Wait()
+		return nil, err
+	}
+
+	// the tree is identical to what we rendered last time so we only need
+	// the readme for the summary page. A rev is only recorded once every
+	// page of it was written.
+	treeIndex := filepath.Join(c.Outdir, getTreeBaseDir(pageData.RevData), "index.html")
+	if c.Manifest.hasRev(revName, revID) && fileExists(treeIndex) && c.hasSearch(pageData.RevData) && c.revPagesExist(pageData.RevData) {
+		c.Logger.Info("revision unchanged since last build, skipping tree", "revision", revName)
+		readme, err := c.findReadme(tree)
+		err = c.reportErr(err, revName, "readme")
+		if err != nil {
+			_ = eg.Wait()
+			return nil, err
+		}
+		output.Readme = readme
+		c.Manifest.addRev(revName, revID, true)
+		return output, eg.Wait()
+	}
+
+	// `git log` is pretty expensive for a large repo, so we have flags to
+	// disable history pages and the last commit of each file
+	var lastCommits *revLastCommits
+	var history *revHistory
+	if !c.NoHistory {
+		history, err = c.revHistory(repo, pageData.RevData)
+		// the tree is still usable without history pages
+		err = c.reportErr(err, revName, "history")
+		if err != nil {
+			_ = eg.Wait()
+			return nil, err
+		}
+		if history != nil && !c.HideTreeLastCommit {
+			lastCommits = history.lastCommits(revID)
+		}
+	} else if !c.HideTreeLastCommit {
+		lastCommits, err = c.lastCommits(repo, pageData.RevData)
+		// the tree is still usable without the last commit of each file
+		err = c.reportErr(err, revName, "last commits")
+		if err != nil {
+			_ = eg.Wait()
+			return nil, err
+		}
+	}
+
+	readme := ""
+	entries := make(chan *treeItem)
+	subtrees := make(chan *treeRoot)
+	tw := &treeWalker{
+		Config:      c,
+		PageData:    pageData,
+		Repo:        repo,
+		Root:        tree,
+		LastCommits: lastCommits,
+		History:     history,
+		treeItem:    entries,
+		tree:        subtrees,
+	}
+	var walking, files errgroup.Group
+	walking.Go(func() error {
+		defer close(entries)
+		defer close(subtrees)
+		return tw.walk(tree, "")
+	})
+
+	walking.Go(func() error {
+		for e := range entries {
+			search.addItem(e)
+			// directories and submodules only have a history page
+			if (e.IsDir || e.Submodule != nil) && history == nil {
+				continue
+			}
+			c.Pool.Go(&files, func() error {
+				if e.IsDir || e.Submodule != nil {
+					err := c.writeHistory(repo, pageData, e, history)
+					return c.reportErr(err, revName, string(e.HistoryURL))
+				}
+
+				readmeStr, err := c.writeHTMLTreeFile(repo, pageData, e, history, search)
+				if readmeStr != "" {
+					readme = readmeStr
+				}
+				return c.reportErr(err, revName, e.Path)
+			})
+		}
+		return nil
+	})
+
+	roots := []*treeRoot{}
+	walking.Go(func() error {
+		for t := range subtrees {
+			roots = append(roots, t)
+		}
+		return nil
+	})
+
+	// tree pages show the line count we find while writing each file page so
+	// they are written last
+	eg.Go(func() error {
+		err := walking.Wait()
+		fileErr := files.Wait()
+		if err != nil {
+			return err
+		}
+		if fileErr != nil {
+			return fileErr
+		}
+
+		var trees errgroup.Group
+		for _, t := range roots {
+			c.Pool.Go(&trees, func() error {
+				err := c.writeTree(pageData, t)
+				return c.reportErr(err, revName, t.Path)
+			})
+		}
+		return trees.Wait()
+	})
+
+	err = eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.reportErr(c.writeSearch(pageData, search), revName, "search")
+	if err != nil {
+		return nil, err
+	}
+
+	// pages that failed are written again by the next build, the files
+	// that made it are still skipped
+	if !c.Report.hasRevErrors(c.RepoName, revName) {
+		c.Manifest.addRev(revName, revID, false)
+	}
+
+	c.Logger.Info(
+		"compilation complete",
+		"repoName", c.RepoName,
+		"revision", pageData.RevData.Name(),
+	)
+
+	output.Readme = readme
+	return output, nil
+}
+
+func style(theme chroma.Style) string {
+	bg := theme.Get(chroma.Background)
+	txt := theme.Get(chroma.Text)
+	kw := theme.Get(chroma.Keyword)
+	nv := theme.Get(chroma.NameVariable)
+	cm := theme.Get(chroma.Comment)
+	ln := theme.Get(chroma.LiteralNumber)
+	return fmt.Sprintf(`:root {
+  --bg-color: %s;
+  --text-color: %s;
+  --border: %s;
+  --link-color: %s;
+  --hover: %s;
+  --visited: %s;
+}`,
+		bg.Background.String(),
+		txt.Colour.String(),
+		cm.Colour.String(),
+		nv.Colour.String(),
+		kw.Colour.String(),
+		ln.Colour.String(),
+	)
+}
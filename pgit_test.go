@@ -0,0 +1,144 @@
+package pgit
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetNumLogs(t *testing.T) {
+	tests := []struct {
+		total      int
+		maxCommits int
+		want       int
+	}{
+		{25, 0, 25},
+		{25, -1, 25},
+		{0, 3, 0},
+		// the newest page is partial, we never load less than it
+		{25, 3, 5},
+		{25, 5, 5},
+		// older pages are always loaded whole
+		{25, 6, 15},
+		{25, 15, 15},
+		{25, 16, 25},
+		{30, 3, 10},
+		{30, 11, 20},
+	}
+	for _, tt := range tests {
+		c := &config{MaxCommits: tt.maxCommits, LogPageSize: 10}
+		got := c.getNumLogs(tt.total)
+		if got != tt.want {
+			t.Errorf("getNumLogs(%d) with max %d: got %d, want %d", tt.total, tt.maxCommits, got, tt.want)
+		}
+	}
+}
+
+func TestGetLogPages(t *testing.T) {
+	tests := []struct {
+		total  int
+		loaded int
+		want   []logPage
+	}{
+		{0, 0, []logPage{}},
+		{10, 10, []logPage{{1, 0, 10}}},
+		{25, 25, []logPage{{3, 0, 5}, {2, 5, 15}, {1, 15, 25}}},
+		{30, 30, []logPage{{3, 0, 10}, {2, 10, 20}, {1, 20, 30}}},
+		// with max commits we stop after the last page we loaded
+		{25, 15, []logPage{{3, 0, 5}, {2, 5, 15}}},
+		{25, 7, []logPage{{3, 0, 5}, {2, 5, 7}}},
+	}
+	for _, tt := range tests {
+		got := getLogPages(tt.total, tt.loaded, 10)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getLogPages(%d, %d): got %v, want %v", tt.total, tt.loaded, got, tt.want)
+		}
+	}
+}
+
+// testBuild generates the main branch of the repo into outdir.
+func testBuild(t *testing.T, dir, outdir string) *BuildReport {
+	t.Helper()
+	return testBuildOpts(t, Options{RepoPath: dir, Outdir: outdir})
+}
+
+func testBuildOpts(t *testing.T, opts Options) *BuildReport {
+	t.Helper()
+	opts.Revs = []string{"main"}
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	generator, err := NewGenerator(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := generator.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// A page that failed has to be written by the next build even though the
+// rev did not change.
+func TestRetryFailedPages(t *testing.T) {
+	dir := testRepo(t)
+	testCommit(t, dir, 1, "first", map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	outdir := t.TempDir()
+	page := filepath.Join(outdir, "tree", "main", "item", "a.txt.html")
+
+	// a directory in the way of the page makes it fail
+	err := os.MkdirAll(page, os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !testBuild(t, dir, outdir).HasErrors() {
+		t.Fatal("expected the page to fail")
+	}
+
+	err = os.Remove(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testBuild(t, dir, outdir).HasErrors() {
+		t.Fatal("expected the build to succeed")
+	}
+	if !fileExists(page) {
+		t.Fatal("failed page was not written again")
+	}
+
+	// pages that went missing from an unchanged rev are written again too
+	raw := filepath.Join(outdir, "raw", "main", "b.txt")
+	err = os.Remove(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBuild(t, dir, outdir)
+	if !fileExists(raw) {
+		t.Fatal("missing raw file was not written again")
+	}
+}
+
+// A revert brings back a blob we rendered before, the file page still has to
+// show the commit that did it.
+func TestRevertedFilePage(t *testing.T) {
+	dir := testRepo(t)
+	testCommit(t, dir, 1, "first", map[string]string{"a.txt": "a\n"})
+	outdir := t.TempDir()
+	testBuild(t, dir, outdir)
+
+	// the change and its revert land between two builds
+	testCommit(t, dir, 2, "second", map[string]string{"a.txt": "b\n"})
+	revert := testCommit(t, dir, 3, "revert", map[string]string{"a.txt": "a\n"})
+	testBuild(t, dir, outdir)
+
+	b, err := os.ReadFile(filepath.Join(outdir, "tree", "main", "item", "a.txt.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), getShortID(revert)) {
+		t.Fatal("file page does not show the reverting commit")
+	}
+}
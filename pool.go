@@ -0,0 +1,72 @@
+package pgit
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// how often the pool logs its progress
+const progressInterval = 2 * time.Second
+
+// workerPool limits how many pages are rendered at once. Every rev and repo
+// shares one pool so `--jobs` bounds page rendering no matter how many revs we
+// build. It does not bound the goroutine of each rev or the `git` processes
+// it runs to walk the tree and read the history, those run next to the pool.
+//
+// Jobs must not schedule other jobs, only the goroutines that coordinate a
+// rev (walking the tree, reading the log) do. Otherwise every worker could end
+// up waiting on a worker.
+type workerPool struct {
+	sem    chan struct{}
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	queued     int
+	done       int
+	lastReport time.Time
+}
+
+func newWorkerPool(jobs int, logger *slog.Logger) *workerPool {
+	return &workerPool{
+		sem:        make(chan struct{}, max(jobs, 1)),
+		logger:     logger,
+		lastReport: time.Now(),
+	}
+}
+
+// Go waits for a free worker and runs fn on it as part of eg. Waiting here
+// rather than in the goroutine keeps the number of goroutines bounded too.
+func (p *workerPool) Go(eg *errgroup.Group, fn func() error) {
+	p.sem <- struct{}{}
+	p.mu.Lock()
+	p.queued += 1
+	p.mu.Unlock()
+
+	eg.Go(func() error {
+		defer p.finish()
+		return fn()
+	})
+}
+
+func (p *workerPool) finish() {
+	<-p.sem
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += 1
+	if time.Since(p.lastReport) < progressInterval {
+		return
+	}
+	p.lastReport = time.Now()
+	p.logger.Info("progress", "done", p.done, "scheduled", p.queued, "running", len(p.sem))
+}
+
+// report logs the final count of jobs.
+func (p *workerPool) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.logger.Info("progress", "done", p.done, "scheduled", p.queued)
+}
@@ -0,0 +1,358 @@
+package pgit
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	git "github.com/gogs/git-module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/sync/errgroup"
+)
+
+type tagData struct {
+	Name string
+	URL  template.URL
+	// tag object id for annotated tags, commit id for lightweight tags
+	ID          string
+	IsAnnotated bool
+	Message     string
+	Tagger      *git.Signature
+	When        time.Time
+	WhenStr     string
+	Commit      *commitData
+	// commits since the previous tag
+	Commits []*commitData
+	Prev    *tagData
+	// set when the tag is one of the revisions we generated a tree for
+	TreeURL template.URL
+	// set when we write archives of the tag
+	Archive *archiveData
+}
+
+type releasesPageData struct {
+	*pageData
+	Tags []*tagData
+}
+
+type tagPageData struct {
+	*pageData
+	Tag *tagData
+}
+
+// tagSemver returns the canonical semantic version of a tag name, if any.
+// Tags are allowed to omit the leading "v" (e.g. "1.2.3").
+func tagSemver(name string) string {
+	v := name
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !semver.IsValid(v) {
+		return ""
+	}
+	return v
+}
+
+// sortTags sorts tags newest first. Tags that parse as semantic versions come
+// first ordered by version, the rest are ordered by date.
+func sortTags(tags []*tagData) {
+	sort.SliceStable(tags, func(i, j int) bool {
+		vi := tagSemver(tags[i].Name)
+		vj := tagSemver(tags[j].Name)
+		if vi != "" && vj != "" {
+			if cmp := semver.Compare(vi, vj); cmp != 0 {
+				return cmp > 0
+			}
+			return tags[i].When.After(tags[j].When)
+		}
+		if vi != "" || vj != "" {
+			return vi != ""
+		}
+		return tags[i].When.After(tags[j].When)
+	})
+}
+
+func (c *config) getTagURL(name string) template.URL {
+	return c.compileURL("/releases", fmt.Sprintf("%s.html", name))
+}
+
+func (c *config) getReleasesURL() template.URL {
+	url := c.RootRelative + "releases.html"
+	return template.URL(url)
+}
+
+func (c *config) getReleasesFeedURL() template.URL {
+	url := c.RootRelative + "releases.xml"
+	return template.URL(url)
+}
+
+// loadTags reads every tag in the repo along with its annotation. Tags we
+// cannot read are reported and skipped.
+func (c *config) loadTags(repo *git.Repository, refs []*refInfo) ([]*tagData, error) {
+	names, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []*tagData{}
+	for _, name := range names {
+		tag, err := repo.Tag(name)
+		if err != nil {
+			err = c.reportErr(err, name, "")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		commit, err := tag.Commit()
+		if err != nil {
+			// tags can point to trees and blobs
+			c.Logger.Info("tag does not point to a commit, skipping", "tag", name, "err", err)
+			continue
+		}
+
+		data := &tagData{
+			Name:   name,
+			URL:    c.getTagURL(name),
+			ID:     tag.ID().String(),
+			Commit: c.newCommitData(commit, refs),
+			When:   commit.Committer.When,
+		}
+		if tag.Type() == git.ObjectTag {
+			data.IsAnnotated = true
+			data.Message = tag.Message()
+			data.Tagger = tag.Tagger()
+			if data.Tagger != nil {
+				data.When = data.Tagger.When
+			}
+		}
+		data.WhenStr = data.When.Format(time.DateOnly)
+
+		for _, ref := range refs {
+			if ref.Refspec == name && ref.URL != "" {
+				data.TreeURL = ref.URL
+			}
+		}
+
+		tags = append(tags, data)
+	}
+
+	sortTags(tags)
+
+	byName := map[string]*tagData{}
+	for _, tag := range tags {
+		byName[tag.Name] = tag
+	}
+	for _, tag := range tags {
+		tag.Prev = prevTag(repo, tag, byName)
+	}
+
+	return tags, nil
+}
+
+// prevTag finds the nearest tag in the history of a tag. The sort order is
+// no help here because tags on other branches or with names that are not
+// versions sort next to unrelated tags.
+func prevTag(repo *git.Repository, tag *tagData, byName map[string]*tagData) *tagData {
+	var prev *tagData
+	distance := -1
+	// a tag on the same commit is not a previous release, so we start from
+	// every parent
+	for i := 0; i < tag.Commit.ParentsCount(); i++ {
+		parent, err := tag.Commit.Commit.ParentID(i)
+		if err != nil {
+			continue
+		}
+		out, err := git.NewCommand(
+			"describe", "--tags", "--long", parent.String(),
+		).RunInDir(repo.Path())
+		// no tag in the history of this parent
+		if err != nil {
+			continue
+		}
+
+		name, dist, ok := parseDescribe(strings.TrimSpace(string(out)))
+		if !ok || byName[name] == nil {
+			continue
+		}
+		if prev == nil || dist < distance {
+			prev = byName[name]
+			distance = dist
+		}
+	}
+	return prev
+}
+
+// parseDescribe splits the output of `git describe --long`, e.g.
+// `v1.0.0-3-g2414721`, into the tag and the number of commits since. Tags
+// can contain dashes so we split from the end.
+func parseDescribe(out string) (string, int, bool) {
+	parts := strings.Split(out, "-")
+	if len(parts) < 3 {
+		return "", 0, false
+	}
+	dist, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), dist, true
+}
+
+// commitsSinceTag finds the commits reachable from a tag that are not
+// reachable from the previous tag.
+func (c *config) commitsSinceTag(repo *git.Repository, tag *tagData, refs []*refInfo) ([]*commitData, error) {
+	rev := tag.Commit.ID.String()
+	if tag.Prev != nil {
+		rev = fmt.Sprintf("%s..%s", tag.Prev.Commit.ID.String(), rev)
+	}
+
+	commits, err := repo.Log(rev, git.LogOptions{MaxCount: c.getMaxCommits()})
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []*commitData{}
+	for _, commit := range commits {
+		logs = append(logs, c.newCommitData(commit, refs))
+	}
+	return logs, nil
+}
+
+func (c *config) writeTag(repo *git.Repository, data *pageData, tag *tagData, refs []*refInfo) error {
+	commits, err := c.commitsSinceTag(repo, tag, refs)
+	if err != nil {
+		return err
+	}
+	tag.Commits = commits
+
+	err = c.writeHtml(&writeData{
+		Filename: fmt.Sprintf("%s.html", filepath.Base(tag.Name)),
+		Subdir:   filepath.Join("releases", filepath.Dir(tag.Name)),
+		Template: "tag.page.tmpl",
+		Data: &tagPageData{
+			pageData: data,
+			Tag:      tag,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// make sure every commit we link to has a commit page
+	for _, commit := range append([]*commitData{tag.Commit}, tag.Commits...) {
+		err = c.writeLogDiff(repo, data, commit)
+		err = c.reportErr(err, commit.ID.String(), "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReleases writes a page per tag along with the releases index and feed.
+// Tags that fail are reported and skipped.
+func (c *config) writeReleases(repo *git.Repository, data *pageData, tags []*tagData, refs []*refInfo) error {
+	c.Logger.Info("writing releases", "repoPath", c.RepoPath)
+
+	var eg errgroup.Group
+	for _, tag := range tags {
+		c.Pool.Go(&eg, func() error {
+			err := c.writeTag(repo, data, tag, refs)
+			return c.reportErr(err, tag.Name, "")
+		})
+	}
+	err := eg.Wait()
+	if err != nil {
+		return err
+	}
+
+	err = c.writeHtml(&writeData{
+		Filename: "releases.html",
+		Template: "releases.page.tmpl",
+		Data: &releasesPageData{
+			pageData: data,
+			Tags:     tags,
+		},
+	})
+	err = c.reportErr(err, "", "releases.html")
+	if err != nil {
+		return err
+	}
+
+	return c.reportErr(c.writeReleasesFeed(tags), "", "releases.xml")
+}
+
+// writeReleasesFeed writes an atom feed of tags. Feeds are only generated
+// when `BaseURL` is set.
+func (c *config) writeReleasesFeed(tags []*tagData) error {
+	if c.BaseURL == "" {
+		return nil
+	}
+
+	c.Logger.Info("writing releases feed", "repoPath", c.RepoPath)
+	feedURL, err := c.absURL(c.getReleasesFeedURL())
+	if err != nil {
+		return err
+	}
+	releasesURL, err := c.absURL(c.getReleasesURL())
+	if err != nil {
+		return err
+	}
+
+	feed := &atomFeed{
+		Title: fmt.Sprintf("%s releases", c.RepoName),
+		ID:    feedURL,
+		Links: []*atomLink{
+			{Href: feedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: releasesURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	latest := time.Time{}
+	for i, tag := range tags {
+		if i >= feedSize {
+			break
+		}
+		if tag.When.After(latest) {
+			latest = tag.When
+		}
+
+		tagURL, err := c.absURL(tag.URL)
+		if err != nil {
+			return err
+		}
+
+		author := tag.Commit.Author
+		if tag.Tagger != nil {
+			author = tag.Tagger
+		}
+		msg := tag.Message
+		if msg == "" {
+			msg = tag.Commit.Message
+		}
+
+		feed.Entries = append(feed.Entries, &atomEntry{
+			Title:   tag.Name,
+			ID:      tagURL,
+			Updated: atomTime(tag.When),
+			Author: &atomPerson{
+				Name:  author.Name,
+				Email: author.Email,
+			},
+			Links:   []*atomLink{{Href: tagURL, Rel: "alternate", Type: "text/html"}},
+			Content: &atomText{Type: "text", Body: msg},
+		})
+	}
+
+	if latest.IsZero() {
+		latest = time.Now()
+	}
+	feed.Updated = atomTime(latest)
+
+	return c.writeFeed("/", "releases.xml", feed)
+}
@@ -0,0 +1,118 @@
+package pgit
+
+import (
+	"testing"
+	"time"
+
+	git "github.com/gogs/git-module"
+)
+
+func TestSortTags(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	tags := []*tagData{
+		{Name: "nightly", When: day(9)},
+		{Name: "v1.0.0", When: day(1)},
+		{Name: "2.0", When: day(3)},
+		{Name: "old", When: day(2)},
+		{Name: "v1.1.0", When: day(2)},
+		{Name: "v1.1.0-rc1", When: day(4)},
+	}
+	sortTags(tags)
+
+	want := []string{"2.0", "v1.1.0", "v1.1.0-rc1", "v1.0.0", "nightly", "old"}
+	for i, tag := range tags {
+		if tag.Name != want[i] {
+			t.Fatalf("position %d: got %s, want %s", i, tag.Name, want[i])
+		}
+	}
+}
+
+func TestParseDescribe(t *testing.T) {
+	tests := []struct {
+		out  string
+		name string
+		dist int
+		ok   bool
+	}{
+		{"v1.0.0-0-g2414721", "v1.0.0", 0, true},
+		{"v1.0.0-rc-1-12-g2414721", "v1.0.0-rc-1", 12, true},
+		{"nightly-3-gabcdef0", "nightly", 3, true},
+		{"2414721", "", 0, false},
+		{"v1-x-g2414721", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, dist, ok := parseDescribe(tt.out)
+		if name != tt.name || dist != tt.dist || ok != tt.ok {
+			t.Errorf("%s: got (%q, %d, %v), want (%q, %d, %v)", tt.out, name, dist, ok, tt.name, tt.dist, tt.ok)
+		}
+	}
+}
+
+// Tags sort by version first but the previous release has to come from the
+// history, otherwise a tag that is not a version ends up next to an
+// unrelated one.
+func TestLoadTagsPrev(t *testing.T) {
+	dir := testRepo(t)
+	testCommit(t, dir, 1, "first", map[string]string{"a.txt": "1"})
+	testGit(t, dir, "tag", "v1.0.0")
+	testCommit(t, dir, 2, "second", map[string]string{"a.txt": "2"})
+	testGit(t, dir, "tag", "v1.1.0")
+	testCommit(t, dir, 3, "third", map[string]string{"a.txt": "3"})
+	testGit(t, dir, "tag", "-a", "-m", "two", "2.0")
+	testCommit(t, dir, 4, "fourth", map[string]string{"a.txt": "4"})
+	testCommit(t, dir, 5, "fifth", map[string]string{"a.txt": "5"})
+	testGit(t, dir, "tag", "nightly")
+	// a tag on a side branch is not in the history of main
+	testGit(t, dir, "checkout", "-q", "-b", "side", "v1.0.0")
+	testCommit(t, dir, 6, "side", map[string]string{"b.txt": "1"})
+	testGit(t, dir, "tag", "side-1")
+
+	repo, err := git.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testConfig(t)
+	tags, err := c.loadTags(repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]*tagData{}
+	for _, tag := range tags {
+		byName[tag.Name] = tag
+	}
+	tests := []struct {
+		tag     string
+		prev    string
+		commits int
+	}{
+		{"nightly", "2.0", 2},
+		{"2.0", "v1.1.0", 1},
+		{"v1.1.0", "v1.0.0", 1},
+		{"v1.0.0", "", 1},
+		{"side-1", "v1.0.0", 1},
+	}
+	for _, tt := range tests {
+		tag := byName[tt.tag]
+		if tag == nil {
+			t.Fatalf("%s: tag not loaded", tt.tag)
+		}
+		prev := ""
+		if tag.Prev != nil {
+			prev = tag.Prev.Name
+		}
+		if prev != tt.prev {
+			t.Errorf("%s: got previous tag %q, want %q", tt.tag, prev, tt.prev)
+		}
+
+		commits, err := c.commitsSinceTag(repo, tag, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(commits) != tt.commits {
+			t.Errorf("%s: got %d commits since the previous tag, want %d", tt.tag, len(commits), tt.commits)
+		}
+	}
+}
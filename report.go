@@ -0,0 +1,126 @@
+package pgit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// BuildError is a failure to generate part of the site.
+type BuildError struct {
+	Repo string
+	// revision, commit or tag we were generating, if any
+	Rev string
+	// file, directory or page we were generating, if any
+	Path string
+	Err  error
+}
+
+func (e *BuildError) Error() string {
+	scope := []string{}
+	if e.Repo != "" {
+		scope = append(scope, fmt.Sprintf("repo=%s", e.Repo))
+	}
+	if e.Rev != "" {
+		scope = append(scope, fmt.Sprintf("rev=%s", e.Rev))
+	}
+	if e.Path != "" {
+		scope = append(scope, fmt.Sprintf("path=%s", e.Path))
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(scope, " "), e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// BuildReport collects the pages we rendered and the errors we skipped over
+// during a build.
+type BuildReport struct {
+	mu     sync.Mutex
+	Errors []*BuildError
+	// absolute path of every html page this build rendered. It is not a list
+	// of the output directory: pages the manifest skipped because they did
+	// not change are left out and so is everything that is not a page, e.g.
+	// raw files, patches, archives, feeds and assets. The unchanged pages are
+	// still in the output directory, `pgit-manifest.json` next to them lists
+	// the commits, revs and files they were rendered from.
+	Rendered []string
+}
+
+func (r *BuildReport) add(err *BuildError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, err)
+}
+
+func (r *BuildReport) addRendered(fp string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Rendered = append(r.Rendered, fp)
+}
+
+// hasRevErrors reports whether a page of the rev failed.
+func (r *BuildReport) hasRevErrors(repo, rev string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, err := range r.Errors {
+		if err.Repo == repo && err.Rev == rev {
+			return true
+		}
+	}
+	return false
+}
+
+// HasErrors reports whether any part of the site failed to generate.
+func (r *BuildReport) HasErrors() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Errors) > 0
+}
+
+// Write prints a summary of the build to w.
+func (r *BuildReport) Write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Errors) == 0 {
+		fmt.Fprintln(w, "build finished without errors")
+		return
+	}
+
+	fmt.Fprintf(w, "build finished with %d error(s), the following were skipped:\n", len(r.Errors))
+	for _, err := range r.Errors {
+		fmt.Fprintf(w, "  %s\n", err)
+	}
+}
+
+// reportErr records a failure to generate part of the site so the build can
+// move on. The error is returned when `FailFast` is set so the caller stops.
+func (c *config) reportErr(err error, rev, fpath string) error {
+	if err == nil {
+		return nil
+	}
+
+	// already reported further down the stack
+	var berr *BuildError
+	if errors.As(err, &berr) {
+		return berr
+	}
+
+	berr = &BuildError{
+		Repo: c.RepoName,
+		Rev:  rev,
+		Path: fpath,
+		Err:  err,
+	}
+	c.Logger.Error("could not generate page, skipping", "rev", rev, "path", fpath, "err", err)
+	c.Report.add(berr)
+
+	if c.FailFast {
+		return berr
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package pgit
+
+import (
+	"encoding/json"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// files larger than this are left out of the trigram index.
+const maxSearchFileSize = 512 * 1024
+
+// searchIndex is the json the search page loads for a revision. Urls are
+// built in the browser from the prefixes to keep the index small.
+type searchIndex struct {
+	FileURL   string `json:"fileURL"`
+	CommitURL string `json:"commitURL"`
+	RawURL    string `json:"rawURL"`
+	// raw files with these extensions end with RawSuffix
+	RawSuffix     string   `json:"rawSuffix"`
+	RawSuffixExts []string `json:"rawSuffixExts"`
+	// file and directory paths, directories end with a slash
+	Files []string `json:"files"`
+	// [commit id, summary, message]
+	Commits [][3]string `json:"commits"`
+}
+
+// trigramIndex maps every trigram found in a text file to the position of the
+// file in `searchIndex.Files`. The search page uses it to narrow down which
+// raw files to fetch and grep.
+type trigramIndex struct {
+	Trigrams map[string][]int `json:"trigrams"`
+}
+
+type searchPageData struct {
+	*pageData
+	IndexURL    template.URL
+	TrigramsURL template.URL
+}
+
+// searchCollector gathers what we index while a revision is written.
+type searchCollector struct {
+	mu       sync.Mutex
+	files    []string
+	commits  []*commitData
+	trigrams map[string]map[string]bool
+}
+
+func newSearchCollector() *searchCollector {
+	return &searchCollector{trigrams: map[string]map[string]bool{}}
+}
+
+func (s *searchCollector) addItem(item *treeItem) {
+	// submodules have no page to link to
+	if item.Submodule != nil {
+		return
+	}
+
+	fpath := item.Path
+	if item.IsDir {
+		fpath += "/"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, fpath)
+}
+
+func (s *searchCollector) addCommits(logs []*commitData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commits = logs
+}
+
+// addText indexes the contents of a text file.
+func (s *searchCollector) addText(fpath, text string) {
+	if len(text) > maxSearchFileSize {
+		return
+	}
+
+	tris := trigrams(text)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trigrams[fpath] = tris
+}
+
+// trigrams returns every case-insensitive trigram in text that does not span
+// lines or start with whitespace.
+func trigrams(text string) map[string]bool {
+	tris := map[string]bool{}
+	for _, line := range strings.Split(strings.ToLower(text), "\n") {
+		runes := []rune(line)
+		for i := 0; i+3 <= len(runes); i++ {
+			if unicode.IsSpace(runes[i]) {
+				continue
+			}
+			tris[string(runes[i:i+3])] = true
+		}
+	}
+	return tris
+}
+
+func getSearchBaseDir(info revInfo) string {
+	subdir := getRevIDForURL(info)
+	return filepath.Join("/", "search", subdir)
+}
+
+func (c *config) getSearchURL(info revInfo) template.URL {
+	return c.compileURL(getSearchBaseDir(info), "index.html")
+}
+
+// hasSearch reports whether a previous build wrote the search index we need.
+func (c *config) hasSearch(info revInfo) bool {
+	dir := filepath.Join(c.Outdir, getSearchBaseDir(info))
+	if !fileExists(filepath.Join(dir, "index.json")) {
+		return false
+	}
+	return !c.SearchCode || fileExists(filepath.Join(dir, "trigrams.json"))
+}
+
+func writeJSON(fp string, data any) error {
+	err := os.MkdirAll(filepath.Dir(fp), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fp, b, 0644)
+}
+
+// writeSearch writes the search index and page for a revision.
+func (c *config) writeSearch(data *pageData, search *searchCollector) error {
+	c.Logger.Info("writing search index", "revision", data.RevData.Name())
+	search.mu.Lock()
+	defer search.mu.Unlock()
+
+	subdir := getSearchBaseDir(data.RevData)
+	sort.Strings(search.files)
+	index := &searchIndex{
+		FileURL:   string(c.compileURL(getFileBaseDir(data.RevData), "")) + "/",
+		CommitURL: c.RootRelative + "commits/",
+		RawURL:    string(c.compileURL(getRawBaseDir(data.RevData), "")) + "/",
+		RawSuffix: rawSuffix,
+		Files:     search.files,
+		Commits:   [][3]string{},
+	}
+	for ext := range activeExts {
+		index.RawSuffixExts = append(index.RawSuffixExts, ext)
+	}
+	sort.Strings(index.RawSuffixExts)
+	for _, commit := range search.commits {
+		index.Commits = append(index.Commits, [3]string{
+			commit.ID.String(),
+			commit.SummaryStr,
+			commit.Message,
+		})
+	}
+
+	err := writeJSON(filepath.Join(c.Outdir, subdir, "index.json"), index)
+	if err != nil {
+		return err
+	}
+
+	pageData := &searchPageData{
+		pageData: data,
+		IndexURL: c.compileURL(subdir, "index.json"),
+	}
+
+	if c.SearchCode {
+		tris := &trigramIndex{Trigrams: map[string][]int{}}
+		for i, fpath := range search.files {
+			for tri := range search.trigrams[fpath] {
+				tris.Trigrams[tri] = append(tris.Trigrams[tri], i)
+			}
+		}
+
+		err = writeJSON(filepath.Join(c.Outdir, subdir, "trigrams.json"), tris)
+		if err != nil {
+			return err
+		}
+		pageData.TrigramsURL = c.compileURL(subdir, "trigrams.json")
+	}
+
+	return c.writeHtml(&writeData{
+		Filename: "index.html",
+		Template: "search.page.tmpl",
+		Subdir:   subdir,
+		Data:     pageData,
+	})
+}
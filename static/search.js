@@ -0,0 +1,232 @@
+// client-side search for pgit, loads the index written by `writeSearch` and
+// queries it in the browser.
+(function () {
+  var root = document.getElementById("search");
+  var input = document.getElementById("search-input");
+  var filesEl = document.getElementById("search-files");
+  var codeEl = document.getElementById("search-code");
+  var commitsEl = document.getElementById("search-commits");
+
+  var maxResults = 50;
+  // raw files we fetch to find matching lines
+  var maxCodeFiles = 20;
+
+  var index = null;
+  var trigrams = null;
+  var rawCache = {};
+  var timer = null;
+  var latest = "";
+
+  function getJSON(url) {
+    return fetch(url).then(function (res) {
+      if (!res.ok) {
+        throw new Error("could not load " + url);
+      }
+      return res.json();
+    });
+  }
+
+  function el(tag, attrs, text) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (key) {
+      node.setAttribute(key, attrs[key]);
+    });
+    if (text) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  function section(parent, title, count) {
+    parent.textContent = "";
+    if (count === 0) {
+      return;
+    }
+    var header = el("div");
+    header.appendChild(el("span", { class: "font-bold" }, "(" + count + ")"));
+    header.appendChild(document.createTextNode(" " + title));
+    parent.appendChild(header);
+  }
+
+  function fileURL(path) {
+    if (path.endsWith("/")) {
+      return index.fileURL + path + "index.html";
+    }
+    return index.fileURL + path + ".html";
+  }
+
+  function searchFiles(q) {
+    var results = index.files.filter(function (path) {
+      return path.toLowerCase().indexOf(q) !== -1;
+    });
+    section(filesEl, "files", results.length);
+    results.slice(0, maxResults).forEach(function (path) {
+      var row = el("div", { class: "mono" });
+      row.appendChild(el("a", { href: fileURL(path) }, path));
+      filesEl.appendChild(row);
+    });
+  }
+
+  function searchCommits(q) {
+    var results = index.commits.filter(function (commit) {
+      return (
+        commit[0].indexOf(q) === 0 ||
+        commit[2].toLowerCase().indexOf(q) !== -1
+      );
+    });
+    section(commitsEl, "commits", results.length);
+    results.slice(0, maxResults).forEach(function (commit) {
+      var row = el("div");
+      row.appendChild(
+        el(
+          "a",
+          { href: index.commitURL + commit[0] + ".html", class: "mono" },
+          commit[0].slice(0, 7),
+        ),
+      );
+      row.appendChild(document.createTextNode(" " + commit[1]));
+      commitsEl.appendChild(row);
+    });
+  }
+
+  // must match `trigrams` in search.go
+  function queryTrigrams(q) {
+    var runes = Array.from(q);
+    var tris = [];
+    for (var i = 0; i + 3 <= runes.length; i++) {
+      if (/\s/.test(runes[i])) {
+        continue;
+      }
+      tris.push(runes.slice(i, i + 3).join(""));
+    }
+    return tris;
+  }
+
+  // files that contain every trigram of the query, these still need to be
+  // checked because trigrams can match out of order.
+  function candidates(q) {
+    var tris = queryTrigrams(q);
+    if (tris.length === 0) {
+      return [];
+    }
+    var found = null;
+    for (var i = 0; i < tris.length; i++) {
+      var ids = trigrams[tris[i]] || [];
+      if (found === null) {
+        found = ids.slice();
+      } else {
+        found = found.filter(function (id) {
+          return ids.indexOf(id) !== -1;
+        });
+      }
+      if (found.length === 0) {
+        break;
+      }
+    }
+    return found || [];
+  }
+
+  // mirrors `getRawFilename`, pages are served as text
+  function getRawURL(path) {
+    var dot = path.lastIndexOf(".");
+    var ext = dot > path.lastIndexOf("/") ? path.slice(dot).toLowerCase() : "";
+    var suffix = (index.rawSuffixExts || []).indexOf(ext) !== -1 ? index.rawSuffix : "";
+    return index.rawURL + path + suffix;
+  }
+
+  function getRaw(path) {
+    if (!rawCache[path]) {
+      rawCache[path] = fetch(getRawURL(path)).then(function (res) {
+        return res.ok ? res.text() : "";
+      });
+    }
+    return rawCache[path];
+  }
+
+  function searchCode(q) {
+    codeEl.textContent = "";
+    if (!trigrams || Array.from(q).length < 3) {
+      return;
+    }
+
+    var paths = candidates(q)
+      .slice(0, maxCodeFiles)
+      .map(function (id) {
+        return index.files[id];
+      });
+
+    Promise.all(paths.map(getRaw)).then(function (texts) {
+      // a newer query already replaced these results
+      if (q !== latest) {
+        return;
+      }
+
+      var matches = [];
+      texts.forEach(function (text, i) {
+        text.split("\n").forEach(function (line, n) {
+          if (line.toLowerCase().indexOf(q) !== -1) {
+            matches.push({ path: paths[i], line: n + 1, text: line.trim() });
+          }
+        });
+      });
+
+      section(codeEl, "code", matches.length);
+      matches.slice(0, maxResults).forEach(function (match) {
+        var row = el("div", { class: "mono" });
+        row.appendChild(
+          el(
+            "a",
+            { href: fileURL(match.path) + "#" + match.line },
+            match.path + ":" + match.line,
+          ),
+        );
+        row.appendChild(el("pre", { class: "m-0" }, match.text));
+        codeEl.appendChild(row);
+      });
+    });
+  }
+
+  function search() {
+    var q = input.value.trim().toLowerCase();
+    latest = q;
+    if (q === "") {
+      filesEl.textContent = "";
+      codeEl.textContent = "";
+      commitsEl.textContent = "";
+      return;
+    }
+
+    searchFiles(q);
+    searchCommits(q);
+    searchCode(q);
+  }
+
+  var loading = [
+    getJSON(root.dataset.index).then(function (data) {
+      index = data;
+    }),
+  ];
+  if (root.dataset.trigrams) {
+    loading.push(
+      getJSON(root.dataset.trigrams).then(function (data) {
+        trigrams = data.trigrams;
+      }),
+    );
+  }
+
+  Promise.all(loading)
+    .then(function () {
+      var params = new URLSearchParams(window.location.search);
+      if (params.get("q")) {
+        input.value = params.get("q");
+      }
+      input.addEventListener("input", function () {
+        clearTimeout(timer);
+        timer = setTimeout(search, 150);
+      });
+      search();
+    })
+    .catch(function (err) {
+      filesEl.textContent = err.message;
+    });
+})();
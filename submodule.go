@@ -0,0 +1,117 @@
+package pgit
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	git "github.com/gogs/git-module"
+)
+
+// submoduleData is a gitlink in a tree, the commit of another repo pinned at
+// a path.
+type submoduleData struct {
+	CommitID string
+	ShortID  string
+	// url from `.gitmodules`, empty when it is missing
+	URL string
+	// set when the url can be opened in a browser
+	Link template.URL
+}
+
+// submoduleChange is a diff of a gitlink, ids are empty when the submodule was
+// added or removed.
+type submoduleChange struct {
+	OldID string
+	NewID string
+	URL   string
+	Link  template.URL
+}
+
+// submoduleLink turns the url of a submodule into one for a browser, ssh urls
+// like `git@github.com:picosh/pgit.git` become https. Relative urls depend on
+// where the repo was cloned from so they are not linked.
+func submoduleLink(rawURL string) template.URL {
+	if rawURL == "" || strings.HasPrefix(rawURL, ".") {
+		return ""
+	}
+
+	// scp-like syntax: user@host:path
+	if !strings.Contains(rawURL, "://") {
+		at := strings.Index(rawURL, "@")
+		colon := strings.Index(rawURL, ":")
+		if colon == -1 || colon < at {
+			return ""
+		}
+		rawURL = "https://" + rawURL[at+1:colon] + "/" + rawURL[colon+1:]
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ssh", "git":
+		u.Scheme = "https"
+		u.User = nil
+		u.Host = u.Hostname()
+	default:
+		return ""
+	}
+	u.Path = strings.TrimSuffix(u.Path, ".git")
+	return template.URL(u.String())
+}
+
+// submoduleURL reads the url of a submodule from `.gitmodules` at a commit.
+func submoduleURL(commit *git.Commit, fpath string) (string, error) {
+	mod, err := commit.Submodule(fpath)
+	if err != nil {
+		return "", err
+	}
+	return mod.URL, nil
+}
+
+// newSubmodule describes a gitlink entry, the entry is listed without a url
+// when `.gitmodules` cannot be read.
+func (tw *treeWalker) newSubmodule(entry *git.TreeEntry, fpath string) (*submoduleData, error) {
+	sub := &submoduleData{
+		CommitID: entry.ID().String(),
+		ShortID:  getShortID(entry.ID().String()),
+	}
+
+	commit, err := tw.Repo.CatFileCommit(tw.PageData.RevData.ID())
+	if err != nil {
+		return sub, err
+	}
+	sub.URL, err = submoduleURL(commit, fpath)
+	if err != nil {
+		return sub, err
+	}
+	sub.Link = submoduleLink(sub.URL)
+	return sub, nil
+}
+
+// newSubmoduleChange describes the commits of a submodule before and after a
+// commit.
+func newSubmoduleChange(commit *git.Commit, file *git.DiffFile) *submoduleChange {
+	change := &submoduleChange{}
+	if file.Type != git.DiffFileAdd {
+		change.OldID = file.OldIndex
+	}
+	if file.Type != git.DiffFileDelete {
+		change.NewID = file.Index
+	}
+
+	// a removed submodule is usually gone from `.gitmodules` too
+	rawURL, err := submoduleURL(commit, file.Name)
+	if err == nil {
+		change.URL = rawURL
+		change.Link = submoduleLink(rawURL)
+	}
+	return change
+}
+
+func isSubmoduleDiff(file *git.DiffFile) bool {
+	return file.IsSubmodule() || file.Mode() == git.EntryCommit || file.OldMode() == git.EntryCommit
+}
@@ -0,0 +1,35 @@
+package pgit
+
+import (
+	"html/template"
+	"testing"
+)
+
+func TestSubmoduleLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want template.URL
+	}{
+		{"https://github.com/picosh/pgit.git", "https://github.com/picosh/pgit"},
+		{"http://example.com/repo", "http://example.com/repo"},
+		{"git@github.com:picosh/pgit.git", "https://github.com/picosh/pgit"},
+		{"github.com:picosh/pgit", "https://github.com/picosh/pgit"},
+		{"ssh://git@github.com:22/picosh/pgit.git", "https://github.com/picosh/pgit"},
+		{"git://git.kernel.org/pub/linux.git", "https://git.kernel.org/pub/linux"},
+		// relative to where the repo was cloned from
+		{"../lib.git", ""},
+		{"./lib", ""},
+		// not on a web host
+		{"", ""},
+		{"/srv/git/lib.git", ""},
+		{"file:///srv/git/lib.git", ""},
+		{"ftp://example.com/lib.git", ""},
+		{"git@example.com", ""},
+	}
+	for _, tt := range tests {
+		got := submoduleLink(tt.url)
+		if got != tt.want {
+			t.Errorf("submoduleLink(%q): got %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}